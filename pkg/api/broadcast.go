@@ -0,0 +1,17 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+type Broadcaster interface {
+	Subscribe(ctx context.Context) <-chan *Frame
+}
+
+// CachingBroadcaster remembers the last frame it published
+type CachingBroadcaster interface {
+	Broadcaster
+	// Latest returns the last frame with the time it was published, nil before the first frame
+	Latest() (*Frame, time.Time)
+}
@@ -1,18 +1,109 @@
 package api
 
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultDevice      = "/dev/video0"
+	DefaultCameraName  = "default"
+	DefaultFrameRate   = 15
+	DefaultJPEGQuality = 85
+	DefaultSubWidth    = 320
+	DefaultSubQuality  = 70
+)
+
+const (
+	SourceV4L2        = "v4l2"
+	SourceTestPattern = "testpattern"
+	// SourceFileScheme prefixes replayed captures: file:///path
+	SourceFileScheme = "file"
+)
+
 const (
-	DefaultDevice = "/dev/video0"
+	PixelFormatAuto  = "auto"
+	PixelFormatMJPEG = "mjpeg"
+	PixelFormatYUYV  = "yuyv"
+	PixelFormatNV12  = "nv12"
 )
 
 type Camera interface {
-	ReadFrames() <-chan []byte
+	Broadcaster
+	Name() string
+	Description() string
+	Options() *CameraOption
+	ReadFrames() <-chan *Frame
+	// Snapshot returns a recent frame, waiting for the next one when the last is outdated
+	Snapshot(ctx context.Context) (*Frame, error)
+	// SubStream serves the downscaled secondary output
+	SubStream() SubStream
+	// Pipeline reports the latency of the processing stages
+	Pipeline() *PipelineStatistics
+	// Health reports whether frames arrive at the expected rate
+	Health() *Health
+	Controls() ([]*Control, error)
+	SetControl(id uint32, value int32) error
+	Resolution() (*Resolution, error)
+	// SetResolution reopens the device with a new capture size, subscribers stay connected
+	SetResolution(width, height int) error
+	ROI() *ROI
+	// SetROI changes the region of interest, nil resets to the full frame
+	SetROI(roi *ROI) error
+	State() string
+	// Start opens the device of a stopped camera
+	Start() error
+	// Stop releases the device, subscribers stay connected
+	Stop() error
+	// Pause stops delivering frames but keeps the device open
+	Pause() error
+	Resume() error
+	// Wake keeps the device open for at least the duration, even without subscribers
+	Wake(duration time.Duration)
 }
 
 type Device interface {
-	GetOutput() <-chan []byte
+	GetOutput() <-chan *Frame
+	// Close stops the capture and releases the device
+	Close() error
 }
 
 type CameraOption struct {
+	Name          string
+	Source        string
+	Device        string
 	CaptureHeight int
 	CaptureWidth  int
+	FrameRate     int
+	// PixelFormat selects the capture format, raw formats are encoded to JPEG in process
+	PixelFormat string
+	JPEGQuality int
+	// StateDirectory stores settings changed at runtime, nothing is persisted when empty
+	StateDirectory string
+	// Controls holds control values applied whenever the device is opened
+	Controls map[uint32]int32
+	// ROI zooms on a part of the frame, the full frame is streamed when nil
+	ROI *ROI
+	// Loop restarts replayed captures once they ended
+	Loop bool
+	// Processors run in order after the built-in transform and zoom stages
+	Processors []FrameProcessor
+	// Rotation turns the image clockwise by 0, 90, 180 or 270 degrees,
+	// the flips are applied to the rotated image
+	Rotation       int
+	HorizontalFlip bool
+	VerticalFlip   bool
+	// SubWidth and SubHeight size the secondary output,
+	// a missing dimension keeps the aspect ratio
+	SubWidth   int
+	SubHeight  int
+	SubQuality int
+	// StallTimeout is the delay without frame after which the device is recovered,
+	// it defaults to a few seconds and is at least a few frame intervals
+	StallTimeout time.Duration
+	// StallRecovery is the action taken on a stall: reopen or exit
+	StallRecovery string
+	// IdleTimeout closes the device once nobody subscribed for that long,
+	// it is opened again by the next subscriber. The device stays open when 0
+	IdleTimeout time.Duration
 }
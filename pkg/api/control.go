@@ -0,0 +1,43 @@
+package api
+
+import "errors"
+
+var ErrorUnsupported = errors.New("not supported by the camera source")
+
+// ErrorOffline is returned when the camera device is currently unavailable
+var ErrorOffline = errors.New("camera is offline")
+
+// ControllableDevice is implemented by devices exposing
+// user and camera controls (brightness, exposure...)
+type ControllableDevice interface {
+	Device
+	Controls() ([]*Control, error)
+	SetControl(id uint32, value int32) error
+}
+
+type Control struct {
+	ID      uint32             `json:"id"`
+	Name    string             `json:"name"`
+	Key     string             `json:"key"`
+	Type    string             `json:"type"`
+	Value   int32              `json:"value"`
+	Minimum int32              `json:"minimum"`
+	Maximum int32              `json:"maximum"`
+	Step    int32              `json:"step"`
+	Default int32              `json:"default"`
+	Menu    []*ControlMenuItem `json:"menu,omitempty"`
+}
+
+type ControlMenuItem struct {
+	Index uint32 `json:"index"`
+	Name  string `json:"name"`
+}
+
+const (
+	ControlTypeInteger     = "integer"
+	ControlTypeBoolean     = "boolean"
+	ControlTypeMenu        = "menu"
+	ControlTypeIntegerMenu = "integer-menu"
+	ControlTypeButton      = "button"
+	ControlTypeOther       = "other"
+)
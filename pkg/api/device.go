@@ -0,0 +1,48 @@
+package api
+
+// DeviceInfo describes a V4L2 device node and what it can capture
+type DeviceInfo struct {
+	Path         string        `json:"path"`
+	Driver       string        `json:"driver"`
+	Card         string        `json:"card"`
+	BusInfo      string        `json:"busInfo"`
+	Capabilities []string      `json:"capabilities"`
+	Formats      []*FormatInfo `json:"formats"`
+	Error        string        `json:"error,omitempty"`
+}
+
+type FormatInfo struct {
+	PixelFormat string           `json:"pixelFormat"`
+	Description string           `json:"description"`
+	Sizes       []*FrameSizeInfo `json:"sizes"`
+}
+
+// FrameSizeInfo holds a single resolution for discrete sizes,
+// or the resolution range for stepwise and continuous sizes
+type FrameSizeInfo struct {
+	Type       string           `json:"type"`
+	Width      int              `json:"width,omitempty"`
+	Height     int              `json:"height,omitempty"`
+	MinWidth   int              `json:"minWidth,omitempty"`
+	MaxWidth   int              `json:"maxWidth,omitempty"`
+	StepWidth  int              `json:"stepWidth,omitempty"`
+	MinHeight  int              `json:"minHeight,omitempty"`
+	MaxHeight  int              `json:"maxHeight,omitempty"`
+	StepHeight int              `json:"stepHeight,omitempty"`
+	FrameRates []*FrameRateInfo `json:"frameRates,omitempty"`
+}
+
+// FrameRateInfo holds a single frame rate for discrete intervals,
+// or the frame rate range for stepwise and continuous intervals
+type FrameRateInfo struct {
+	Type         string  `json:"type"`
+	FrameRate    float64 `json:"frameRate,omitempty"`
+	MinFrameRate float64 `json:"minFrameRate,omitempty"`
+	MaxFrameRate float64 `json:"maxFrameRate,omitempty"`
+}
+
+const (
+	SizeTypeDiscrete   = "discrete"
+	SizeTypeStepwise   = "stepwise"
+	SizeTypeContinuous = "continuous"
+)
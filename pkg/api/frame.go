@@ -0,0 +1,18 @@
+package api
+
+import "time"
+
+// Frame is a single JPEG image with its capture metadata
+type Frame struct {
+	Data []byte
+	// Timestamp is the capture time reported by the device
+	Timestamp time.Time
+	// Sequence is incremented by the device for every captured frame,
+	// gaps reveal dropped frames
+	Sequence    uint32
+	Width       int
+	Height      int
+	PixelFormat string
+	// Placeholder marks frames rendered while the device is offline
+	Placeholder bool
+}
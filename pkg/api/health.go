@@ -0,0 +1,31 @@
+package api
+
+// health states reported by the stall watchdog
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthOffline  = "offline"
+	HealthStopped  = "stopped"
+	HealthIdle     = "idle"
+)
+
+// recovery actions taken when a device stalls
+const (
+	// StallRecoveryReopen closes and opens the device again
+	StallRecoveryReopen = "reopen"
+	// StallRecoveryExit terminates the process with a non-zero code,
+	// leaving the restart to the service manager
+	StallRecoveryExit = "exit"
+)
+
+// Health reports the frame delivery of a camera, durations are in milliseconds
+type Health struct {
+	State            string  `json:"state"`
+	LastFrame        string  `json:"lastFrame,omitempty"`
+	SinceLastFrame   float64 `json:"sinceLastFrameMs"`
+	ExpectedInterval float64 `json:"expectedIntervalMs"`
+	StallTimeout     float64 `json:"stallTimeoutMs"`
+	Recovery         string  `json:"recovery"`
+	// Stalls counts the recoveries triggered since the start
+	Stalls uint64 `json:"stalls"`
+}
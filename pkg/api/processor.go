@@ -0,0 +1,33 @@
+package api
+
+// FrameProcessor is a stage of the camera pipeline between capture and output,
+// like an overlay, a transform or a motion analysis.
+// Returning a nil frame without error drops the frame
+type FrameProcessor interface {
+	Name() string
+	Process(frame *Frame) (*Frame, error)
+}
+
+// Pipeline runs frames through an ordered list of processors
+type Pipeline interface {
+	Output() <-chan *Frame
+	Statistics() *PipelineStatistics
+}
+
+// PipelineStatistics reports the frames flowing through the processing stages
+type PipelineStatistics struct {
+	// Skipped counts frames discarded because the first stage was still busy
+	Skipped uint64             `json:"skipped"`
+	Stages  []*StageStatistics `json:"stages"`
+}
+
+// StageStatistics holds the latency of a stage in milliseconds
+type StageStatistics struct {
+	Name           string  `json:"name"`
+	Processed      uint64  `json:"processed"`
+	Dropped        uint64  `json:"dropped"`
+	Errors         uint64  `json:"errors"`
+	LastLatency    float64 `json:"lastLatencyMs"`
+	AverageLatency float64 `json:"averageLatencyMs"`
+	MaximumLatency float64 `json:"maximumLatencyMs"`
+}
@@ -0,0 +1,8 @@
+package api
+
+type Registry interface {
+	Add(camera Camera) error
+	Get(name string) (Camera, error)
+	Default() (Camera, error)
+	Names() []string
+}
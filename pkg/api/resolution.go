@@ -0,0 +1,21 @@
+package api
+
+import "errors"
+
+// ErrorInvalidResolution is returned for resolutions the device cannot capture
+var ErrorInvalidResolution = errors.New("resolution not supported by the device")
+
+type Resolution struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Sizes lists the frame sizes supported with the current pixel format
+	Sizes []*FrameSizeInfo `json:"sizes,omitempty"`
+}
+
+// SizingDevice is implemented by devices able to report their supported frame sizes
+type SizingDevice interface {
+	Device
+	FrameSizes() ([]*FrameSizeInfo, error)
+	// Size returns the frame size applied by the driver, which may differ from the requested one
+	Size() (width, height int)
+}
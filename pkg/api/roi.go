@@ -0,0 +1,20 @@
+package api
+
+// ROI is a region of interest relative to the full frame,
+// all values range from 0 to 1 so that it survives resolution changes
+type ROI struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// CroppingDevice is implemented by devices able to apply
+// the region of interest of the camera options in hardware
+type CroppingDevice interface {
+	Device
+	// Cropped reports whether the driver applied the region of interest
+	Cropped() bool
+	// CanCrop reports whether the driver supports cropping at all
+	CanCrop() bool
+}
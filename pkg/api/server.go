@@ -1,6 +1,9 @@
 package api
 
 type ServerOptions struct {
-	Port    string
-	Address string
+	Port          string
+	Address       string
+	DefaultCamera string
+	// RTSPPort enables the RTSP listener serving every camera, disabled when empty
+	RTSPPort string
 }
@@ -0,0 +1,24 @@
+package api
+
+import "errors"
+
+// camera states, offline is reported while a running camera waits for its device
+// and idle while it closed the device for lack of viewers
+const (
+	CameraStateRunning = "running"
+	CameraStatePaused  = "paused"
+	CameraStateStopped = "stopped"
+	CameraStateOffline = "offline"
+	CameraStateIdle    = "idle"
+)
+
+// ErrorInvalidState is returned when a transition is not allowed from the current state
+var ErrorInvalidState = errors.New("invalid camera state transition")
+
+type CameraStatus struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Default bool   `json:"default,omitempty"`
+	// Viewers counts the active streams
+	Viewers int `json:"viewers"`
+}
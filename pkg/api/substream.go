@@ -0,0 +1,9 @@
+package api
+
+// SubStream is a downscaled copy of the camera output,
+// frames are only encoded while it has subscribers
+type SubStream interface {
+	Broadcaster
+	// Resize downscales a single frame to the size of the stream
+	Resize(frame *Frame) (*Frame, error)
+}
@@ -0,0 +1,8 @@
+package api
+
+// FlippingDevice is implemented by devices able to flip the image in hardware
+type FlippingDevice interface {
+	Device
+	// Flipped reports whether the driver applied the flips of the transform
+	Flipped() bool
+}
@@ -0,0 +1,150 @@
+package broadcast
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+const (
+	// DefaultQueueSize is the number of frames buffered per subscriber
+	// before the oldest ones get dropped
+	DefaultQueueSize = 2
+)
+
+func New(ctx context.Context, source <-chan *api.Frame) *broadcaster {
+	instance := new(broadcaster)
+
+	instance.source = source
+	instance.queueSize = DefaultQueueSize
+	instance.subscribers = make(map[*subscriber]struct{})
+	instance.done = make(chan struct{})
+
+	go instance.run(ctx)
+
+	return instance
+}
+
+var _ api.CachingBroadcaster = &broadcaster{}
+
+type broadcaster struct {
+	source      <-chan *api.Frame
+	queueSize   int
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+	done        chan struct{}
+	latest      *api.Frame
+	latestAt    time.Time
+}
+
+type subscriber struct {
+	queue   chan *api.Frame
+	dropped int
+}
+
+// Subscribe returns a channel receiving every frame read from the source.
+// The channel is closed once the context ends or the source is exhausted.
+func (i *broadcaster) Subscribe(ctx context.Context) <-chan *api.Frame {
+	sub := &subscriber{
+		queue: make(chan *api.Frame, i.queueSize),
+	}
+
+	i.mutex.Lock()
+	if i.closed {
+		i.mutex.Unlock()
+		close(sub.queue)
+		return sub.queue
+	}
+	i.subscribers[sub] = struct{}{}
+	count := len(i.subscribers)
+	i.mutex.Unlock()
+
+	log.Debug().Msgf("subscriber added, %d active", count)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			i.unsubscribe(sub)
+		case <-i.done:
+		}
+	}()
+
+	return sub.queue
+}
+
+func (i *broadcaster) Latest() (*api.Frame, time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.latest, i.latestAt
+}
+
+func (i *broadcaster) unsubscribe(sub *subscriber) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, ok := i.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(i.subscribers, sub)
+	close(sub.queue)
+
+	log.Debug().Msgf("subscriber removed after %d dropped frames, %d active", sub.dropped, len(i.subscribers))
+}
+
+func (i *broadcaster) run(ctx context.Context) {
+	defer i.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-i.source:
+			if !ok {
+				return
+			}
+			i.publish(frame)
+		}
+	}
+}
+
+// publish never blocks: when a subscriber queue is full,
+// its oldest frame is discarded to make room for the new one
+func (i *broadcaster) publish(frame *api.Frame) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.latest = frame
+	i.latestAt = time.Now()
+
+	for sub := range i.subscribers {
+		select {
+		case sub.queue <- frame:
+		default:
+			select {
+			case <-sub.queue:
+			default:
+			}
+			sub.queue <- frame
+			sub.dropped = sub.dropped + 1
+		}
+	}
+}
+
+func (i *broadcaster) close() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for sub := range i.subscribers {
+		close(sub.queue)
+	}
+
+	i.subscribers = make(map[*subscriber]struct{})
+	i.closed = true
+	close(i.done)
+}
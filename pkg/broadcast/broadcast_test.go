@@ -0,0 +1,119 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func receive(t *testing.T, frames <-chan *api.Frame) (*api.Frame, bool) {
+	select {
+	case frame, ok := <-frames:
+		return frame, ok
+	case <-time.After(time.Second):
+		t.Fatal("timeout while waiting for a frame")
+	}
+	return nil, false
+}
+
+func waitForSubscribers(b *broadcaster, count int) {
+	for {
+		b.mutex.Lock()
+		current := len(b.subscribers)
+		b.mutex.Unlock()
+
+		if current == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_SubscribersReceiveEveryFrame(t *testing.T) {
+	source := make(chan *api.Frame)
+	b := New(context.Background(), source)
+
+	first := b.Subscribe(context.Background())
+	second := b.Subscribe(context.Background())
+
+	for _, content := range []string{"a", "b"} {
+		source <- &api.Frame{Data: []byte(content)}
+
+		frame, ok := receive(t, first)
+		assert.True(t, ok)
+		assert.Equal(t, content, string(frame.Data))
+
+		frame, ok = receive(t, second)
+		assert.True(t, ok)
+		assert.Equal(t, content, string(frame.Data))
+	}
+}
+
+func Test_SlowSubscriberDropsOldestFrames(t *testing.T) {
+	source := make(chan *api.Frame)
+	b := New(context.Background(), source)
+
+	slow := b.Subscribe(context.Background())
+
+	for _, content := range []string{"a", "b", "c", "d"} {
+		source <- &api.Frame{Data: []byte(content)}
+	}
+
+	// make sure the last frame was published
+	close(source)
+	<-b.done
+
+	frames := []string{}
+	for frame := range slow {
+		frames = append(frames, string(frame.Data))
+	}
+
+	assert.Equal(t, []string{"c", "d"}, frames)
+}
+
+func Test_UnsubscribeOnContextEnd(t *testing.T) {
+	source := make(chan *api.Frame)
+	b := New(context.Background(), source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	frames := b.Subscribe(ctx)
+	waitForSubscribers(b, 1)
+
+	cancel()
+
+	_, ok := receive(t, frames)
+	assert.False(t, ok)
+	waitForSubscribers(b, 0)
+}
+
+func Test_SubscribeAfterSourceEnd(t *testing.T) {
+	source := make(chan *api.Frame)
+	b := New(context.Background(), source)
+
+	close(source)
+	<-b.done
+
+	_, ok := receive(t, b.Subscribe(context.Background()))
+	assert.False(t, ok)
+}
+
+func Test_LatestFrame(t *testing.T) {
+	source := make(chan *api.Frame)
+	b := New(context.Background(), source)
+
+	frame, _ := b.Latest()
+	assert.Nil(t, frame)
+
+	// published without subscriber
+	source <- &api.Frame{Data: []byte("a")}
+	source <- &api.Frame{Data: []byte("b")}
+	close(source)
+	<-b.done
+
+	frame, at := b.Latest()
+	assert.Equal(t, "b", string(frame.Data))
+	assert.WithinDuration(t, time.Now(), at, time.Second)
+}
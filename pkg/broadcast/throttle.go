@@ -0,0 +1,42 @@
+package broadcast
+
+import "time"
+
+// NewThrottle limits a frame sequence to the given frame rate,
+// a frame rate of zero or less lets every frame through
+func NewThrottle(frameRate float64) *throttle {
+	instance := new(throttle)
+
+	if frameRate > 0 {
+		instance.interval = time.Duration(float64(time.Second) / frameRate)
+	}
+
+	return instance
+}
+
+type throttle struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// Allow reports whether a frame received at the given time should be kept.
+// Deadlines advance by whole intervals so that the output rate does not
+// drift below the target when the source rate is not a multiple of it
+func (i *throttle) Allow(now time.Time) bool {
+	if i.interval == 0 {
+		return true
+	}
+
+	if now.Before(i.next) {
+		return false
+	}
+
+	i.next = i.next.Add(i.interval)
+
+	// first frame or the source stalled for more than an interval
+	if i.next.Before(now) {
+		i.next = now.Add(i.interval)
+	}
+
+	return true
+}
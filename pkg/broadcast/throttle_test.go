@@ -0,0 +1,64 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Throttle(t *testing.T) {
+	cases := []struct {
+		name       string
+		frameRate  float64
+		sourceRate int
+		duration   time.Duration
+		expected   int
+	}{
+		{
+			name:       "unlimited",
+			frameRate:  0,
+			sourceRate: 30,
+			duration:   time.Second,
+			expected:   30,
+		},
+		{
+			name:       "2 fps out of 30",
+			frameRate:  2,
+			sourceRate: 30,
+			duration:   5 * time.Second,
+			expected:   10,
+		},
+		{
+			name:       "4 fps out of 15",
+			frameRate:  4,
+			sourceRate: 15,
+			duration:   5 * time.Second,
+			expected:   20,
+		},
+		{
+			name:       "higher than the source",
+			frameRate:  60,
+			sourceRate: 15,
+			duration:   time.Second,
+			expected:   15,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			throttle := NewThrottle(c.frameRate)
+			start := time.Now()
+			interval := time.Second / time.Duration(c.sourceRate)
+
+			allowed := 0
+			for now := start; now.Sub(start) < c.duration; now = now.Add(interval) {
+				if throttle.Allow(now) {
+					allowed = allowed + 1
+				}
+			}
+
+			assert.InDelta(tt, c.expected, allowed, 1)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package camera
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// idleCheckInterval bounds how late an idle device is closed
+const idleCheckInterval = time.Second
+
+// supervise keeps the device open while it is in demand: without idle timeout
+// it always is, otherwise the device is opened by the first subscriber
+// and closed once nobody subscribed for the idle timeout
+func (i *camera) supervise(ctx context.Context) {
+	if i.options.IdleTimeout <= 0 {
+		i.run(ctx)
+		return
+	}
+
+	for i.waitForDemand(ctx) {
+		active, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			i.run(active)
+		}()
+
+		i.waitForIdle(ctx)
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Info().Msgf("camera \"%s\" idle for %s, device closed", i.Name(), i.options.IdleTimeout)
+	}
+}
+
+// waitForDemand returns false when the context ended,
+// even while consumers are still registered
+func (i *camera) waitForDemand(ctx context.Context) bool {
+	i.setIdle(true)
+
+	for !i.inDemand(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-i.demand:
+		}
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	i.setIdle(false)
+
+	return true
+}
+
+func (i *camera) waitForIdle(ctx context.Context) {
+	ticker := time.NewTicker(min(idleCheckInterval, i.options.IdleTimeout))
+	defer ticker.Stop()
+
+	var idleSince time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			switch {
+			case i.inDemand(now):
+				idleSince = time.Time{}
+			case idleSince.IsZero():
+				idleSince = now
+			case now.Sub(idleSince) >= i.options.IdleTimeout:
+				return
+			}
+		}
+	}
+}
+
+func (i *camera) inDemand(now time.Time) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.consumers > 0 || now.Before(i.awakeUntil)
+}
+
+func (i *camera) setIdle(idle bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.idle = idle
+}
+
+// acquire registers a consumer until the context ends
+func (i *camera) acquire(ctx context.Context) {
+	i.mutex.Lock()
+	i.consumers = i.consumers + 1
+	i.mutex.Unlock()
+
+	i.signalDemand()
+
+	go func() {
+		<-ctx.Done()
+
+		i.mutex.Lock()
+		defer i.mutex.Unlock()
+
+		i.consumers = i.consumers - 1
+	}()
+}
+
+// Wake keeps the device open for at least the duration,
+// e.g. for scheduled snapshots
+func (i *camera) Wake(duration time.Duration) {
+	i.mutex.Lock()
+	until := time.Now().Add(duration)
+	if until.After(i.awakeUntil) {
+		i.awakeUntil = until
+	}
+	i.mutex.Unlock()
+
+	i.signalDemand()
+}
+
+func (i *camera) signalDemand() {
+	select {
+	case i.demand <- struct{}{}:
+	default:
+	}
+}
+
+// deviceCache keeps what the last open device reported about itself
+// so that an idle camera answers queries without opening it again
+type deviceCache struct {
+	// options the device was opened with
+	options      *api.CameraOption
+	sizing       bool
+	width        int
+	height       int
+	sizes        []*api.FrameSizeInfo
+	controllable bool
+	controls     []*api.Control
+}
+
+// remember caches the sizes and controls of a device which was just opened
+func (i *camera) remember(device api.Device, options *api.CameraOption) {
+	cache := &deviceCache{options: options}
+
+	if sizing, ok := device.(api.SizingDevice); ok {
+		sizes, err := sizing.FrameSizes()
+		if err != nil {
+			log.Debug().Msgf("camera \"%s\": failed to list frame sizes: %s", i.Name(), err)
+		}
+
+		cache.sizing = err == nil
+		cache.width, cache.height = sizing.Size()
+		cache.sizes = sizes
+	}
+
+	if controllable, ok := device.(api.ControllableDevice); ok {
+		controls, err := controllable.Controls()
+		if err != nil {
+			log.Debug().Msgf("camera \"%s\": failed to list controls: %s", i.Name(), err)
+		}
+
+		cache.controllable = err == nil
+		cache.controls = controls
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.cache = cache
+}
+
+func (i *camera) deviceCache() *deviceCache {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.cache
+}
+
+// idleCache returns the cache of an idle camera whose device was opened before
+func (i *camera) idleCache() *deviceCache {
+	if i.State() != api.CameraStateIdle {
+		return nil
+	}
+
+	return i.deviceCache()
+}
+
+// controlValues copies the cached controls with the persisted values,
+// those are reapplied when the device is opened again
+func (i *deviceCache) controlValues(options *api.CameraOption) ([]*api.Control, error) {
+	if !i.controllable {
+		return nil, errors.Wrapf(api.ErrorUnsupported, "camera \"%s\" has no controls", options.Name)
+	}
+
+	controls := make([]*api.Control, 0, len(i.controls))
+	for _, cached := range i.controls {
+		control := *cached
+		if value, ok := options.Controls[control.ID]; ok {
+			control.Value = value
+		}
+		controls = append(controls, &control)
+	}
+
+	return controls, nil
+}
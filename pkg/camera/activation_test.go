@@ -0,0 +1,136 @@
+package camera
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_CameraLazyActivation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+		IdleTimeout:    100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateIdle, waitForState(cam, api.CameraStateIdle))
+	assert.Nil(t, cam.device(), "no device without subscriber")
+
+	viewer, leave := context.WithCancel(ctx)
+	frame, ok := <-cam.Subscribe(viewer)
+	assert.True(t, ok)
+	assert.NotEmpty(t, frame.Data)
+	assert.Equal(t, api.CameraStateRunning, cam.State())
+
+	leave()
+	assert.Equal(t, api.CameraStateIdle, waitForState(cam, api.CameraStateIdle))
+	assert.Nil(t, cam.device())
+
+	cam.Wake(time.Second)
+	assert.Equal(t, api.CameraStateRunning, waitForState(cam, api.CameraStateRunning))
+	assert.Equal(t, api.HealthHealthy, cam.Health().State)
+}
+
+func Test_CameraStopWithSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+		IdleTimeout:    3 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	_, ok := <-cam.Subscribe(ctx)
+	assert.True(t, ok)
+	assert.NoError(t, cam.Pause())
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- cam.Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop did not return while a subscriber is connected")
+	}
+
+	assert.Equal(t, api.CameraStateStopped, cam.State())
+	assert.Nil(t, cam.device())
+
+	assert.NoError(t, cam.Start())
+	assert.Equal(t, api.CameraStateRunning, waitForState(cam, api.CameraStateRunning))
+}
+
+func Test_CameraIdleSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+		IdleTimeout:    100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateIdle, waitForState(cam, api.CameraStateIdle))
+
+	// the device is opened to validate the size
+	assert.NoError(t, cam.SetResolution(320, 240))
+
+	resolution, err := cam.Resolution()
+	assert.NoError(t, err)
+	assert.Equal(t, 320, resolution.Width)
+	assert.NotEmpty(t, resolution.Sizes)
+}
+
+func Test_CameraIdleQueries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+		IdleTimeout:    100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateIdle, waitForState(cam, api.CameraStateIdle))
+
+	viewer, leave := context.WithCancel(ctx)
+	_, ok := <-cam.Subscribe(viewer)
+	assert.True(t, ok)
+	leave()
+	assert.Equal(t, api.CameraStateIdle, waitForState(cam, api.CameraStateIdle))
+
+	// answered from what the device reported while it was open
+	resolution, err := cam.Resolution()
+	assert.NoError(t, err)
+	assert.Equal(t, 64, resolution.Width)
+	assert.NotEmpty(t, resolution.Sizes)
+
+	_, err = cam.Controls()
+	assert.ErrorIs(t, err, api.ErrorUnsupported)
+
+	assert.Equal(t, api.CameraStateIdle, cam.State())
+	assert.Nil(t, cam.device())
+}
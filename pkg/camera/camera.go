@@ -2,20 +2,95 @@ package camera
 
 import (
 	"context"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
+	"github.com/ylallemant/go-picam-streamer/pkg/pipeline"
+)
+
+const (
+	reconnectMinimumDelay = 500 * time.Millisecond
+	reconnectMaximumDelay = 30 * time.Second
+	placeholderInterval   = time.Second
+	// snapshots reuse the last published frame up to this age
+	snapshotMaximumAge = time.Second
+	// snapshotTimeout bounds the wait for a frame of a frozen or offline camera
+	snapshotTimeout = 5 * time.Second
+	// settings of an idle camera wait this long for its device to open
+	deviceWakeTimeout = 5 * time.Second
 )
 
 func New(ctx context.Context, options *api.CameraOption) (*camera, error) {
 	instance := new(camera)
 
-	cam, err := Device(ctx, options)
+	if options.Source == "" {
+		options.Source = api.SourceV4L2
+	}
+
+	if options.Source == api.SourceV4L2 && options.Device == "" {
+		options.Device = api.DefaultDevice
+	}
+
+	if options.Name == "" {
+		options.Name = api.DefaultCameraName
+	}
+
+	instance.options = options
+
+	err := validateSource(options.Source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialise camera \"%s\"", options.Name)
+	}
+
+	err = ValidateRotation(options.Rotation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialise camera \"%s\"", options.Name)
+	}
+
+	err = ValidateStallRecovery(options.StallRecovery)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to initialise camera device %s", api.DefaultDevice)
+		return nil, errors.Wrapf(err, "failed to initialise camera \"%s\"", options.Name)
 	}
 
-	instance.v4l2 = cam
+	err = loadSettings(options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load settings of camera \"%s\"", options.Name)
+	}
+
+	instance.ctx = ctx
+	instance.state = api.CameraStateStopped
+	instance.captured = make(chan *api.Frame, 2)
+	instance.reopen = make(chan struct{}, 1)
+	instance.demand = make(chan struct{}, 1)
+	instance.ready = make(chan struct{})
+	instance.watchdog = newWatchdog(options)
+
+	processors := []api.FrameProcessor{
+		&sanitiseProcessor{},
+		&transformProcessor{camera: instance},
+		&roiProcessor{camera: instance},
+	}
+	processors = append(processors, options.Processors...)
+
+	instance.processing = pipeline.New(ctx, instance.captured, processors...)
+	instance.broadcaster = broadcast.New(ctx, instance.ReadFrames())
+	instance.sub = newSubStream(ctx, options.Name, instance, options)
+
+	err = instance.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		instance.Stop()
+		close(instance.captured)
+	}()
 
 	return instance, nil
 }
@@ -23,9 +98,531 @@ func New(ctx context.Context, options *api.CameraOption) (*camera, error) {
 var _ api.Camera = &camera{}
 
 type camera struct {
-	v4l2 api.Device
+	mutex       sync.Mutex
+	transition  sync.Mutex
+	saving      sync.Mutex
+	options     *api.CameraOption
+	v4l2        api.Device
+	ready       chan struct{}
+	cache       *deviceCache
+	state       string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	captured    chan *api.Frame
+	processing  api.Pipeline
+	reopen      chan struct{}
+	watchdog    *watchdog
+	demand      chan struct{}
+	consumers   int
+	awakeUntil  time.Time
+	idle        bool
+	broadcaster api.CachingBroadcaster
+	sub         api.SubStream
+}
+
+func (i *camera) Name() string {
+	return i.options.Name
+}
+
+// Description returns the device path for V4L2 cameras
+// and the source name otherwise, relay credentials are masked
+func (i *camera) Description() string {
+	if i.options.Source == api.SourceV4L2 {
+		return i.options.Device
+	}
+
+	if isRelay(i.options.Source) {
+		if location, err := url.Parse(i.options.Source); err == nil {
+			return location.Redacted()
+		}
+	}
+
+	return i.options.Source
+}
+
+func (i *camera) Options() *api.CameraOption {
+	return i.options
+}
+
+// ReadFrames returns the processed frame feed consumed by the broadcaster,
+// use Subscribe to receive frames alongside other consumers.
+// The feed survives device reconnections
+func (i *camera) ReadFrames() <-chan *api.Frame {
+	return i.processing.Output()
+}
+
+func (i *camera) Pipeline() *api.PipelineStatistics {
+	return i.processing.Statistics()
 }
 
-func (i *camera) ReadFrames() <-chan []byte {
-	return i.v4l2.GetOutput()
+// Health reports the watchdog state of the open device
+func (i *camera) Health() *api.Health {
+	health := i.watchdog.health(time.Now())
+
+	switch i.State() {
+	case api.CameraStateStopped:
+		health.State = api.HealthStopped
+	case api.CameraStateOffline:
+		health.State = api.HealthOffline
+	case api.CameraStateIdle:
+		health.State = api.HealthIdle
+	}
+
+	return health
+}
+
+// Snapshot returns the last published frame when it is recent,
+// otherwise it waits for the next one, opening the device of an idle camera
+func (i *camera) Snapshot(ctx context.Context) (*api.Frame, error) {
+	frame, at := i.broadcaster.Latest()
+	if frame != nil && !frame.Placeholder && time.Since(at) < snapshotMaximumAge && i.State() == api.CameraStateRunning {
+		return frame, nil
+	}
+
+	waiting, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	for frame := range i.Subscribe(waiting) {
+		// the device is offline, a frame may still come before the timeout
+		if frame.Placeholder {
+			continue
+		}
+
+		return frame, nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if waiting.Err() != nil {
+		return nil, errors.Wrapf(api.ErrorOffline, "camera \"%s\" delivered no frame within %s", i.Name(), snapshotTimeout)
+	}
+
+	return nil, errors.Errorf("camera \"%s\" is shut down", i.Name())
+}
+
+// SubStream returns the downscaled secondary output
+func (i *camera) SubStream() api.SubStream {
+	return i.sub
+}
+
+// Subscribe opens the device of an idle camera
+func (i *camera) Subscribe(ctx context.Context) <-chan *api.Frame {
+	frames := i.broadcaster.Subscribe(ctx)
+	i.acquire(ctx)
+
+	return frames
+}
+
+// Controls of an idle camera are answered from the last open one,
+// with the persisted values, the device is only opened if it never was
+func (i *camera) Controls() ([]*api.Control, error) {
+	if cache := i.idleCache(); cache != nil {
+		return cache.controlValues(i.deviceOptions())
+	}
+
+	device, err := i.controllable()
+	if err != nil {
+		return nil, err
+	}
+
+	return device.Controls()
+}
+
+// SetControl changes a control value and persists it
+// so that it gets reapplied when the device is opened again
+func (i *camera) SetControl(id uint32, value int32) error {
+	device, err := i.controllable()
+	if err != nil {
+		return err
+	}
+
+	err = device.SetControl(id, value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set control %d of camera \"%s\"", id, i.Name())
+	}
+
+	return i.persist(func(options *api.CameraOption) {
+		options.Controls[id] = value
+	})
+}
+
+func (i *camera) controllable() (api.ControllableDevice, error) {
+	opened := i.openDevice()
+	if opened == nil {
+		return nil, errors.Wrapf(api.ErrorOffline, "camera \"%s\"", i.Name())
+	}
+
+	device, ok := opened.(api.ControllableDevice)
+	if !ok {
+		return nil, errors.Wrapf(api.ErrorUnsupported, "camera \"%s\" has no controls", i.Name())
+	}
+
+	return device, nil
+}
+
+// Resolution of an idle camera is answered from the last open one,
+// the device is only opened if it never was
+func (i *camera) Resolution() (*api.Resolution, error) {
+	options := i.deviceOptions()
+	resolution := &api.Resolution{
+		Width:  options.CaptureWidth,
+		Height: options.CaptureHeight,
+	}
+
+	cache := i.idleCache()
+	if cache == nil {
+		i.openDevice()
+		cache = i.deviceCache()
+	}
+
+	if cache == nil || !cache.sizing {
+		return resolution, nil
+	}
+
+	resolution.Sizes = cache.sizes
+
+	// the driver may adjust the size, unless a reopening is still pending
+	if cache.options.CaptureWidth == resolution.Width && cache.options.CaptureHeight == resolution.Height {
+		resolution.Width, resolution.Height = cache.width, cache.height
+	}
+
+	return resolution, nil
+}
+
+// SetResolution validates the size against the open device before
+// reopening it, the frame feed and its subscribers are kept
+func (i *camera) SetResolution(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errors.Wrapf(api.ErrorInvalidResolution, "%dx%d", width, height)
+	}
+
+	device := i.openDevice()
+	if device == nil {
+		return errors.Wrapf(api.ErrorOffline, "camera \"%s\"", i.Name())
+	}
+
+	// relayed and replayed frames keep their recorded size
+	sizing, ok := device.(api.SizingDevice)
+	if !ok {
+		return errors.Wrapf(api.ErrorUnsupported, "camera \"%s\" cannot change its resolution", i.Name())
+	}
+
+	sizes, err := sizing.FrameSizes()
+	if err != nil {
+		return err
+	}
+
+	if !SupportsFrameSize(sizes, width, height) {
+		return errors.Wrapf(api.ErrorInvalidResolution, "camera \"%s\" cannot capture %dx%d", i.Name(), width, height)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.options.CaptureWidth == width && i.options.CaptureHeight == height {
+		return nil
+	}
+
+	i.options.CaptureWidth = width
+	i.options.CaptureHeight = height
+	i.requestReopen()
+
+	log.Info().Msgf("camera \"%s\": resolution set to %dx%d", i.Name(), width, height)
+
+	return nil
+}
+
+func (i *camera) ROI() *api.ROI {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.options.ROI
+}
+
+// SetROI persists the region of interest, devices cropping in hardware
+// are reopened to apply it, the software crop applies from the next frame
+func (i *camera) SetROI(roi *api.ROI) error {
+	err := ValidateROI(roi)
+	if err != nil {
+		return err
+	}
+
+	if IsFullFrame(roi) {
+		roi = nil
+	}
+
+	return i.persist(func(options *api.CameraOption) {
+		options.ROI = roi
+
+		if device, ok := i.v4l2.(api.CroppingDevice); ok && (device.Cropped() || device.CanCrop()) {
+			i.requestReopen()
+		}
+	})
+}
+
+// requestReopen makes the supervisor close and open the device again,
+// pending requests are merged
+func (i *camera) requestReopen() {
+	select {
+	case i.reopen <- struct{}{}:
+	default:
+	}
+}
+
+// deviceOptions copies the options so that the device
+// is opened without racing with runtime changes
+func (i *camera) deviceOptions() *api.CameraOption {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return copyOptions(i.options)
+}
+
+// copyOptions copies the options with their controls, changed at runtime
+func copyOptions(options *api.CameraOption) *api.CameraOption {
+	copied := *options
+	copied.Controls = make(map[uint32]int32, len(options.Controls))
+	for id, value := range options.Controls {
+		copied.Controls[id] = value
+	}
+
+	return &copied
+}
+
+// softwareROI returns the region of interest to crop in process,
+// nil when streaming the full frame or when the device crops itself
+func (i *camera) softwareROI(device api.Device) *api.ROI {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if IsFullFrame(i.options.ROI) {
+		return nil
+	}
+
+	if cropping, ok := device.(api.CroppingDevice); ok && cropping.Cropped() {
+		return nil
+	}
+
+	return i.options.ROI
+}
+
+// softwareTransform returns the part of the transform the device did not apply
+func (i *camera) softwareTransform(device api.Device) transform {
+	i.mutex.Lock()
+	plan := planTransform(i.options)
+	i.mutex.Unlock()
+
+	if flipping, ok := device.(api.FlippingDevice); ok && flipping.Flipped() {
+		plan.hflip = false
+		plan.vflip = false
+	}
+
+	return plan
+}
+
+// openDevice returns the open device, an idle camera is woken
+// and given a few seconds to open it
+func (i *camera) openDevice() api.Device {
+	if i.State() != api.CameraStateIdle {
+		return i.device()
+	}
+
+	i.mutex.Lock()
+	ready := i.ready
+	i.mutex.Unlock()
+
+	i.Wake(deviceWakeTimeout)
+
+	timer := time.NewTimer(deviceWakeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+	case <-timer.C:
+	case <-i.ctx.Done():
+	}
+
+	return i.device()
+}
+
+func (i *camera) device() api.Device {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.v4l2
+}
+
+// setDevice publishes the open device, callers of openDevice
+// waiting for it are released by closing the ready channel
+func (i *camera) setDevice(device api.Device) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.v4l2 = device
+
+	if device == nil {
+		i.ready = make(chan struct{})
+		return
+	}
+
+	select {
+	case <-i.ready:
+	default:
+		close(i.ready)
+	}
+}
+
+// run keeps the device open: a device failing to open, closing its feed
+// or stalling is closed and opened again with an exponential backoff,
+// placeholder frames are sent in the meantime
+func (i *camera) run(ctx context.Context) {
+	delay := reconnectMinimumDelay
+	offlineSince := time.Now()
+
+	for ctx.Err() == nil {
+		options := i.deviceOptions()
+		device, err := Device(ctx, options)
+		if err != nil {
+			log.Error().Msgf("camera \"%s\": %s, retrying in %s", i.Name(), err, delay)
+			i.offline(ctx, offlineSince, delay)
+			delay = min(delay*2, reconnectMaximumDelay)
+			continue
+		}
+
+		log.Info().Msgf("camera \"%s\" online on %s", i.Name(), i.Description())
+		i.remember(device, options)
+		i.setDevice(device)
+		delay = reconnectMinimumDelay
+
+		err = i.forward(ctx, device)
+
+		i.setDevice(nil)
+		if closeErr := device.Close(); closeErr != nil {
+			log.Debug().Msgf("camera \"%s\": failed to close device: %s", i.Name(), closeErr)
+		}
+
+		if err != nil {
+			log.Warn().Msgf("camera \"%s\" lost: %s, reconnecting", i.Name(), err)
+			offlineSince = time.Now()
+		}
+
+		// a pending reopen request is fulfilled by this reopening
+		select {
+		case <-i.reopen:
+		default:
+		}
+	}
+}
+
+// forward passes the device frames to the pipeline until the context ends, a reopening
+// is requested, the device feed closes or the watchdog detects a stall.
+// Frames are still read but discarded while paused
+func (i *camera) forward(ctx context.Context, device api.Device) error {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	i.watchdog.arm(time.Now())
+	frames := device.GetOutput()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-i.reopen:
+			log.Info().Msgf("camera \"%s\": reopening device", i.Name())
+			return nil
+		case now := <-ticker.C:
+			if err := i.watch(now); err != nil {
+				return err
+			}
+		case frame, ok := <-frames:
+			if !ok {
+				return errors.New("device stopped delivering frames")
+			}
+
+			i.watchdog.frame(time.Now())
+
+			if i.paused() {
+				continue
+			}
+
+			select {
+			case i.captured <- frame:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// watch logs changes of the degraded state and applies the recovery
+// action once no frame arrived within the stall timeout
+func (i *camera) watch(now time.Time) error {
+	check := i.watchdog.check(now)
+
+	if check.changed && check.degraded {
+		log.Warn().Msgf("camera \"%s\" degraded: no frame for %s, expected every %s", i.Name(), check.since.Round(time.Millisecond), check.expected.Round(time.Millisecond))
+	} else if check.changed {
+		log.Info().Msgf("camera \"%s\" recovered", i.Name())
+	}
+
+	if !check.stalled {
+		return nil
+	}
+
+	if i.watchdog.recovery == api.StallRecoveryExit {
+		log.Fatal().Msgf("camera \"%s\" stalled: no frame received for %s, exiting", i.Name(), check.timeout)
+	}
+
+	return errors.Errorf("stalled, no frame received for %s", check.timeout)
+}
+
+// offline sends placeholder frames until the delay elapsed
+func (i *camera) offline(ctx context.Context, since time.Time, delay time.Duration) {
+	deadline := time.NewTimer(delay)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(placeholderInterval)
+	defer ticker.Stop()
+
+	i.placeholder(ctx, since, time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			return
+		case now := <-ticker.C:
+			i.placeholder(ctx, since, now)
+		}
+	}
+}
+
+func (i *camera) placeholder(ctx context.Context, since, now time.Time) {
+	if i.paused() {
+		return
+	}
+
+	frame, err := renderPlaceholder(i.deviceOptions(), since, now)
+	if err != nil {
+		log.Debug().Msgf("camera \"%s\": failed to render placeholder: %s", i.Name(), err)
+		return
+	}
+
+	select {
+	case i.captured <- frame:
+	case <-ctx.Done():
+	}
+}
+
+func (i *camera) quality() int {
+	if i.options.JPEGQuality <= 0 {
+		return api.DefaultJPEGQuality
+	}
+
+	return i.options.JPEGQuality
 }
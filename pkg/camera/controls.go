@@ -0,0 +1,39 @@
+package camera
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+var (
+	controlKeyRegexp = regexp.MustCompile("[^a-z0-9]+")
+)
+
+// ControlKey turns a driver control name like "White Balance, Auto"
+// into a key usable in URLs like "white_balance_auto"
+func ControlKey(name string) string {
+	key := controlKeyRegexp.ReplaceAllString(strings.ToLower(name), "_")
+	return strings.Trim(key, "_")
+}
+
+// FindControl resolves a control by its numeric id or its key
+func FindControl(controls []*api.Control, reference string) (*api.Control, error) {
+	id, err := strconv.ParseUint(reference, 10, 32)
+	isID := err == nil
+
+	for _, control := range controls {
+		if isID && control.ID == uint32(id) {
+			return control, nil
+		}
+
+		if !isID && control.Key == ControlKey(reference) {
+			return control, nil
+		}
+	}
+
+	return nil, errors.Errorf("unknown control \"%s\"", reference)
+}
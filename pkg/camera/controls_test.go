@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_ControlKey(t *testing.T) {
+	cases := []struct {
+		name     string
+		control  string
+		expected string
+	}{
+		{
+			name:     "single word",
+			control:  "Brightness",
+			expected: "brightness",
+		},
+		{
+			name:     "punctuation",
+			control:  "White Balance, Auto",
+			expected: "white_balance_auto",
+		},
+		{
+			name:     "parenthesis",
+			control:  "Exposure Time, Absolute (µs)",
+			expected: "exposure_time_absolute_s",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			assert.Equal(tt, c.expected, ControlKey(c.control))
+		})
+	}
+}
+
+func Test_FindControl(t *testing.T) {
+	controls := []*api.Control{
+		{ID: 9963776, Name: "Brightness", Key: "brightness"},
+		{ID: 9963788, Name: "White Balance, Auto", Key: "white_balance_auto"},
+	}
+
+	cases := []struct {
+		name                 string
+		reference            string
+		expectedID           uint32
+		expectError          bool
+		expectedErrorMessage string
+	}{
+		{
+			name:       "by id",
+			reference:  "9963788",
+			expectedID: 9963788,
+		},
+		{
+			name:       "by key",
+			reference:  "brightness",
+			expectedID: 9963776,
+		},
+		{
+			name:       "by name",
+			reference:  "White Balance, Auto",
+			expectedID: 9963788,
+		},
+		{
+			name:                 "unknown",
+			reference:            "zoom",
+			expectError:          true,
+			expectedErrorMessage: "unknown control \"zoom\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			control, err := FindControl(controls, c.reference)
+
+			if c.expectError {
+				assert.Nil(tt, control)
+				assert.NotNil(tt, err)
+				assert.Equal(tt, c.expectedErrorMessage, err.Error(), "wrong error message")
+			} else {
+				assert.Nil(tt, err)
+				assert.Equal(tt, c.expectedID, control.ID)
+			}
+		})
+	}
+}
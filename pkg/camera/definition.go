@@ -0,0 +1,181 @@
+package camera
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// ParseDefinition reads a camera definition of the form
+// "name=/dev/videoN,width=..,height=..,fps=..,format=..,quality=..,loop=..,rotate=..,hflip=..,vflip=..,subwidth=..,subheight=..,subquality=..,stalltimeout=..,stallrecovery=..,idletimeout=..",
+// unset settings are taken from the defaults.
+// A value which is not a device path selects a frame source, e.g. "name=testpattern" or "name=file:///capture.mjpeg",
+// commas of a source URL are kept, its settings start at the first known setting
+func ParseDefinition(definition string, defaults *api.CameraOption) (*api.CameraOption, error) {
+	options := new(api.CameraOption)
+	*options = *defaults
+
+	parts := splitDefinition(definition)
+
+	name, device, found := strings.Cut(parts[0], "=")
+	name = strings.TrimSpace(name)
+	device = strings.TrimSpace(device)
+	if !found || name == "" || device == "" {
+		return nil, errors.Errorf("camera definition \"%s\" must start with name=<device>", definition)
+	}
+
+	options.Name = name
+
+	if strings.HasPrefix(device, "/") {
+		options.Source = api.SourceV4L2
+		options.Device = device
+	} else {
+		options.Source = device
+		options.Device = ""
+	}
+
+	for _, part := range parts[1:] {
+		key, value, found := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !found {
+			return nil, errors.Errorf("camera \"%s\": setting \"%s\" must be of the form key=value", name, part)
+		}
+
+		switch key {
+		case "width":
+			width, err := parseDimension(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\": invalid width", name)
+			}
+			options.CaptureWidth = width
+		case "height":
+			height, err := parseDimension(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\": invalid height", name)
+			}
+			options.CaptureHeight = height
+		case "fps":
+			frameRate, err := strconv.Atoi(value)
+			if err != nil || frameRate <= 0 {
+				return nil, errors.Errorf("camera \"%s\": fps must be a positive integer, got \"%s\"", name, value)
+			}
+			options.FrameRate = frameRate
+		case "format":
+			options.PixelFormat = value
+		case "quality":
+			quality, err := strconv.Atoi(value)
+			if err != nil || quality < 1 || quality > 100 {
+				return nil, errors.Errorf("camera \"%s\": quality must be between 1 and 100, got \"%s\"", name, value)
+			}
+			options.JPEGQuality = quality
+		case "loop":
+			loop, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("camera \"%s\": loop must be true or false, got \"%s\"", name, value)
+			}
+			options.Loop = loop
+		case "rotate":
+			rotation, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errors.Errorf("camera \"%s\": rotate must be a number of degrees, got \"%s\"", name, value)
+			}
+			if err := ValidateRotation(rotation); err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\"", name)
+			}
+			options.Rotation = rotation
+		case "hflip", "vflip":
+			flip, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("camera \"%s\": %s must be true or false, got \"%s\"", name, key, value)
+			}
+			if key == "hflip" {
+				options.HorizontalFlip = flip
+			} else {
+				options.VerticalFlip = flip
+			}
+		case "subwidth":
+			width, err := parseDimension(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\": invalid sub stream width", name)
+			}
+			options.SubWidth = width
+		case "subheight":
+			height, err := parseDimension(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\": invalid sub stream height", name)
+			}
+			options.SubHeight = height
+		case "subquality":
+			quality, err := strconv.Atoi(value)
+			if err != nil || quality < 1 || quality > 100 {
+				return nil, errors.Errorf("camera \"%s\": subquality must be between 1 and 100, got \"%s\"", name, value)
+			}
+			options.SubQuality = quality
+		case "stalltimeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, errors.Errorf("camera \"%s\": stalltimeout must be a positive duration, got \"%s\"", name, value)
+			}
+			options.StallTimeout = timeout
+		case "stallrecovery":
+			if err := ValidateStallRecovery(value); err != nil {
+				return nil, errors.Wrapf(err, "camera \"%s\"", name)
+			}
+			options.StallRecovery = value
+		case "idletimeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				return nil, errors.Errorf("camera \"%s\": idletimeout must be a duration, got \"%s\"", name, value)
+			}
+			options.IdleTimeout = timeout
+		default:
+			return nil, errors.Errorf("camera \"%s\": unknown setting \"%s\"", name, key)
+		}
+	}
+
+	return options, nil
+}
+
+// definitionSettings lists the keys accepted after the source of a camera definition
+var definitionSettings = map[string]bool{
+	"width": true, "height": true, "fps": true, "format": true, "quality": true, "loop": true,
+	"rotate": true, "hflip": true, "vflip": true, "subwidth": true, "subheight": true, "subquality": true,
+	"stalltimeout": true, "stallrecovery": true, "idletimeout": true,
+}
+
+// splitDefinition splits the definition on commas, the parts following a source URL
+// belong to it until the first known setting, e.g. the commas of a query string
+func splitDefinition(definition string) []string {
+	parts := strings.Split(definition, ",")
+	if !strings.Contains(parts[0], "://") {
+		return parts
+	}
+
+	end := 1
+	for end < len(parts) {
+		key, _, _ := strings.Cut(parts[end], "=")
+		if definitionSettings[strings.TrimSpace(key)] {
+			break
+		}
+		end++
+	}
+
+	return append([]string{strings.Join(parts[:end], ",")}, parts[end:]...)
+}
+
+func parseDimension(value string) (int, error) {
+	dimension, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse \"%s\"", value)
+	}
+
+	if dimension <= 0 {
+		return 0, errors.Errorf("dimension must be positive, got %d", dimension)
+	}
+
+	return dimension, nil
+}
@@ -0,0 +1,202 @@
+package camera
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_ParseDefinition(t *testing.T) {
+	defaults := &api.CameraOption{
+		Source:        api.SourceV4L2,
+		Device:        api.DefaultDevice,
+		CaptureWidth:  960,
+		CaptureHeight: 520,
+	}
+
+	cases := []struct {
+		name                 string
+		definition           string
+		expected             *api.CameraOption
+		expectError          bool
+		expectedErrorMessage string
+	}{
+		{
+			name:       "device only",
+			definition: "csi=/dev/video0",
+			expected: &api.CameraOption{
+				Name:          "csi",
+				Source:        api.SourceV4L2,
+				Device:        "/dev/video0",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+			},
+		},
+		{
+			name:       "with dimensions",
+			definition: "usb=/dev/video2, width=640,height=480,fps=30",
+			expected: &api.CameraOption{
+				Name:          "usb",
+				Source:        api.SourceV4L2,
+				Device:        "/dev/video2",
+				CaptureWidth:  640,
+				CaptureHeight: 480,
+				FrameRate:     30,
+			},
+		},
+		{
+			name:       "test pattern source",
+			definition: "bars=testpattern,width=320,height=240",
+			expected: &api.CameraOption{
+				Name:          "bars",
+				Source:        api.SourceTestPattern,
+				CaptureWidth:  320,
+				CaptureHeight: 240,
+			},
+		},
+		{
+			name:       "replay",
+			definition: "field=file:///captures/field.mjpeg,fps=5,loop=true",
+			expected: &api.CameraOption{
+				Name:          "field",
+				Source:        "file:///captures/field.mjpeg",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+				FrameRate:     5,
+				Loop:          true,
+			},
+		},
+		{
+			name:       "relay with commas in the query",
+			definition: "garage=http://192.168.1.20/video.mjpg?resolution=640,480&layers=a,b,fps=5,width=640",
+			expected: &api.CameraOption{
+				Name:          "garage",
+				Source:        "http://192.168.1.20/video.mjpg?resolution=640,480&layers=a,b",
+				CaptureWidth:  640,
+				CaptureHeight: 520,
+				FrameRate:     5,
+			},
+		},
+		{
+			name:       "relay without settings",
+			definition: "garage=http://192.168.1.20/video.mjpg?resolution=640,480",
+			expected: &api.CameraOption{
+				Name:          "garage",
+				Source:        "http://192.168.1.20/video.mjpg?resolution=640,480",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+			},
+		},
+		{
+			name:       "transform",
+			definition: "door=/dev/video0,rotate=270,hflip=true",
+			expected: &api.CameraOption{
+				Name:           "door",
+				Source:         api.SourceV4L2,
+				Device:         "/dev/video0",
+				CaptureWidth:   960,
+				CaptureHeight:  520,
+				Rotation:       270,
+				HorizontalFlip: true,
+			},
+		},
+		{
+			name:       "raw format",
+			definition: "usb=/dev/video2,format=yuyv,quality=70",
+			expected: &api.CameraOption{
+				Name:          "usb",
+				Source:        api.SourceV4L2,
+				Device:        "/dev/video2",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+				PixelFormat:   "yuyv",
+				JPEGQuality:   70,
+			},
+		},
+		{
+			name:       "sub stream",
+			definition: "porch=/dev/video1,subwidth=480,subquality=60",
+			expected: &api.CameraOption{
+				Name:          "porch",
+				Source:        api.SourceV4L2,
+				Device:        "/dev/video1",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+				SubWidth:      480,
+				SubQuality:    60,
+			},
+		},
+		{
+			name:       "stall watchdog",
+			definition: "porch=/dev/video1,stalltimeout=10s,stallrecovery=exit",
+			expected: &api.CameraOption{
+				Name:          "porch",
+				Source:        api.SourceV4L2,
+				Device:        "/dev/video1",
+				CaptureWidth:  960,
+				CaptureHeight: 520,
+				StallTimeout:  10 * time.Second,
+				StallRecovery: api.StallRecoveryExit,
+			},
+		},
+		{
+			name:                 "invalid stall recovery",
+			definition:           "usb=/dev/video2,stallrecovery=restart",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": stall recovery must be reopen or exit, got \"restart\"",
+		},
+		{
+			name:                 "invalid quality",
+			definition:           "usb=/dev/video2,quality=101",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": quality must be between 1 and 100, got \"101\"",
+		},
+		{
+			name:                 "missing device",
+			definition:           "usb,width=640",
+			expectError:          true,
+			expectedErrorMessage: "camera definition \"usb,width=640\" must start with name=<device>",
+		},
+		{
+			name:                 "invalid rotation",
+			definition:           "usb=/dev/video2,rotate=45",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": rotation must be 0, 90, 180 or 270 degrees, got 45",
+		},
+		{
+			name:                 "unknown setting",
+			definition:           "usb=/dev/video2,depth=3",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": unknown setting \"depth\"",
+		},
+		{
+			name:                 "malformed setting",
+			definition:           "usb=/dev/video2,width",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": setting \"width\" must be of the form key=value",
+		},
+		{
+			name:                 "negative dimension",
+			definition:           "usb=/dev/video2,height=-1",
+			expectError:          true,
+			expectedErrorMessage: "camera \"usb\": invalid height: dimension must be positive, got -1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			options, err := ParseDefinition(c.definition, defaults)
+
+			if c.expectError {
+				assert.Nil(tt, options)
+				assert.NotNil(tt, err)
+				assert.Equal(tt, c.expectedErrorMessage, err.Error(), "wrong error message")
+			} else {
+				assert.Nil(tt, err)
+				assert.Equal(tt, c.expected, options)
+			}
+		})
+	}
+}
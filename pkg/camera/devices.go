@@ -0,0 +1,166 @@
+//go:build linux
+
+package camera
+
+import (
+	"strings"
+	sys "syscall"
+
+	"github.com/pkg/errors"
+	"github.com/vladimirvivien/go4vl/device"
+	"github.com/vladimirvivien/go4vl/v4l2"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// ListDevices queries every /dev/video* node for its capabilities,
+// formats, frame sizes and frame rates
+func ListDevices() ([]*api.DeviceInfo, error) {
+	paths, err := device.GetAllDevicePaths()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list V4L2 devices")
+	}
+
+	devices := make([]*api.DeviceInfo, 0)
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/dev/video") {
+			continue
+		}
+
+		info := &api.DeviceInfo{Path: path}
+		if err := describeDevice(info); err != nil {
+			info.Error = err.Error()
+		}
+
+		devices = append(devices, info)
+	}
+
+	return devices, nil
+}
+
+func describeDevice(info *api.DeviceInfo) error {
+	fd, err := v4l2.OpenDevice(info.Path, sys.O_RDWR|sys.O_NONBLOCK, 0)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", info.Path)
+	}
+	defer v4l2.CloseDevice(fd)
+
+	capability, err := v4l2.GetCapability(fd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to query capabilities of %s", info.Path)
+	}
+
+	info.Driver = capability.Driver
+	info.Card = capability.Card
+	info.BusInfo = capability.BusInfo
+
+	descriptions := capability.GetDriverCapDescriptions()
+	if capability.IsDeviceCapabilitiesProvided() {
+		descriptions = capability.GetDeviceCapDescriptions()
+	}
+
+	for _, description := range descriptions {
+		if description.Cap == v4l2.CapDeviceCapabilities {
+			continue
+		}
+		info.Capabilities = append(info.Capabilities, description.Desc)
+	}
+
+	info.Formats = make([]*api.FormatInfo, 0)
+	if !capability.IsVideoCaptureSupported() {
+		return nil
+	}
+
+	formats, err := v4l2.GetAllFormatDescriptions(fd)
+	if len(formats) == 0 && err != nil {
+		return errors.Wrapf(err, "failed to query formats of %s", info.Path)
+	}
+
+	for _, format := range formats {
+		formatInfo := &api.FormatInfo{
+			PixelFormat: FourCC(format.PixelFormat),
+			Description: format.Description,
+			Sizes:       make([]*api.FrameSizeInfo, 0),
+		}
+
+		sizes, err := v4l2.GetFormatFrameSizes(fd, format.PixelFormat)
+		if len(sizes) == 0 && err != nil {
+			return errors.Wrapf(err, "failed to query frame sizes of %s format %s", info.Path, formatInfo.PixelFormat)
+		}
+
+		for _, size := range sizes {
+			formatInfo.Sizes = append(formatInfo.Sizes, describeFrameSize(fd, size))
+		}
+
+		info.Formats = append(info.Formats, formatInfo)
+	}
+
+	return nil
+}
+
+func describeFrameSize(fd uintptr, size v4l2.FrameSizeEnum) *api.FrameSizeInfo {
+	info := new(api.FrameSizeInfo)
+
+	switch size.Type {
+	case v4l2.FrameSizeTypeDiscrete:
+		info.Type = api.SizeTypeDiscrete
+		info.Width = int(size.Size.MinWidth)
+		info.Height = int(size.Size.MinHeight)
+	default:
+		info.Type = api.SizeTypeStepwise
+		if size.Type == v4l2.FrameSizeTypeContinuous {
+			info.Type = api.SizeTypeContinuous
+		}
+		info.MinWidth = int(size.Size.MinWidth)
+		info.MaxWidth = int(size.Size.MaxWidth)
+		info.StepWidth = int(size.Size.StepWidth)
+		info.MinHeight = int(size.Size.MinHeight)
+		info.MaxHeight = int(size.Size.MaxHeight)
+		info.StepHeight = int(size.Size.StepHeight)
+	}
+
+	// frame rates of ranged sizes are reported for the largest resolution
+	info.FrameRates = frameRates(fd, size.PixelFormat, size.Size.MaxWidth, size.Size.MaxHeight)
+
+	return info
+}
+
+func frameRates(fd uintptr, pixelFormat v4l2.FourCCType, width, height uint32) []*api.FrameRateInfo {
+	rates := make([]*api.FrameRateInfo, 0)
+
+	for index := uint32(0); ; index++ {
+		interval, err := v4l2.GetFormatFrameInterval(fd, index, pixelFormat, width, height)
+		if err != nil {
+			break
+		}
+
+		switch interval.Type {
+		case v4l2.FrameIntervalTypeDiscrete:
+			rates = append(rates, &api.FrameRateInfo{
+				Type:      api.SizeTypeDiscrete,
+				FrameRate: frameRate(interval.Interval.Min),
+			})
+		default:
+			rateType := api.SizeTypeStepwise
+			if interval.Type == v4l2.FrameIntervalTypeContinuous {
+				rateType = api.SizeTypeContinuous
+			}
+			// the longest interval is the lowest frame rate
+			rates = append(rates, &api.FrameRateInfo{
+				Type:         rateType,
+				MinFrameRate: frameRate(interval.Interval.Max),
+				MaxFrameRate: frameRate(interval.Interval.Min),
+			})
+			return rates
+		}
+	}
+
+	return rates
+}
+
+func frameRate(interval v4l2.Fract) float64 {
+	if interval.Numerator == 0 {
+		return 0
+	}
+
+	return float64(interval.Denominator) / float64(interval.Numerator)
+}
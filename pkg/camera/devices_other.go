@@ -0,0 +1,12 @@
+//go:build !linux
+
+package camera
+
+import (
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func ListDevices() ([]*api.DeviceInfo, error) {
+	return nil, errors.New("V4L2 devices are only available on Linux")
+}
@@ -0,0 +1,177 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// formatPreferences lists the pixel formats in negotiation order,
+// compressed formats come first as they do not need to be encoded
+var formatPreferences = []struct {
+	name   string
+	format uint32
+}{
+	{name: api.PixelFormatMJPEG, format: PixelFormatMJPEG},
+	{name: api.PixelFormatMJPEG, format: PixelFormatJPEG},
+	{name: api.PixelFormatYUYV, format: PixelFormatYUYV},
+	{name: api.PixelFormatNV12, format: PixelFormatNV12},
+}
+
+// NegotiateFormat picks the pixel format to capture among the ones offered by the device
+func NegotiateFormat(available []uint32, requested string) (uint32, error) {
+	requested = strings.ToLower(requested)
+	if requested == "" {
+		requested = api.PixelFormatAuto
+	}
+
+	offered := make(map[uint32]bool)
+	for _, format := range available {
+		offered[format] = true
+	}
+
+	known := requested == api.PixelFormatAuto
+	for _, preference := range formatPreferences {
+		if requested != api.PixelFormatAuto && requested != preference.name {
+			continue
+		}
+
+		known = true
+		if offered[preference.format] {
+			return preference.format, nil
+		}
+	}
+
+	if !known {
+		return 0, errors.Errorf("unknown pixel format \"%s\"", requested)
+	}
+
+	names := make([]string, 0, len(available))
+	for _, format := range available {
+		names = append(names, FourCC(format))
+	}
+
+	return 0, errors.Errorf("no supported pixel format for \"%s\" among [%s]", requested, strings.Join(names, ", "))
+}
+
+// IsCompressed reports whether frames of the pixel format are already JPEG images
+func IsCompressed(pixelFormat uint32) bool {
+	return pixelFormat == PixelFormatMJPEG || pixelFormat == PixelFormatJPEG
+}
+
+func newRawEncoder(pixelFormat uint32, width, height, stride, quality int) (*rawEncoder, error) {
+	instance := new(rawEncoder)
+
+	instance.pixelFormat = pixelFormat
+	instance.width = width
+	instance.height = height
+	instance.stride = stride
+	instance.quality = quality
+
+	switch pixelFormat {
+	case PixelFormatYUYV:
+		if instance.stride < width*2 {
+			instance.stride = width * 2
+		}
+		instance.image = image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	case PixelFormatNV12:
+		if instance.stride < width {
+			instance.stride = width
+		}
+		instance.image = image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	default:
+		return nil, errors.Errorf("no encoder for pixel format %s", FourCC(pixelFormat))
+	}
+
+	if instance.quality <= 0 {
+		instance.quality = api.DefaultJPEGQuality
+	}
+
+	return instance, nil
+}
+
+// rawEncoder turns raw YUV frames into JPEG images,
+// it is not safe for concurrent use as the image buffer is reused
+type rawEncoder struct {
+	pixelFormat uint32
+	width       int
+	height      int
+	stride      int
+	quality     int
+	image       *image.YCbCr
+}
+
+func (i *rawEncoder) Encode(raw []byte) ([]byte, error) {
+	var err error
+
+	switch i.pixelFormat {
+	case PixelFormatYUYV:
+		err = i.fromYUYV(raw)
+	case PixelFormatNV12:
+		err = i.fromNV12(raw)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	frame := new(bytes.Buffer)
+	err = jpeg.Encode(frame, i.image, &jpeg.Options{Quality: i.quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	return frame.Bytes(), nil
+}
+
+// fromYUYV unpacks Y0 U Y1 V macro pixels into a 4:2:2 image
+func (i *rawEncoder) fromYUYV(raw []byte) error {
+	if len(raw) < i.stride*(i.height-1)+i.width*2 {
+		return errors.Errorf("truncated YUYV frame: %d bytes", len(raw))
+	}
+
+	img := i.image
+	for y := 0; y < i.height; y++ {
+		line := raw[y*i.stride:]
+		yRow := img.Y[y*img.YStride:]
+		cRow := y * img.CStride
+
+		for x := 0; x < i.width/2; x++ {
+			yRow[2*x] = line[4*x]
+			img.Cb[cRow+x] = line[4*x+1]
+			yRow[2*x+1] = line[4*x+2]
+			img.Cr[cRow+x] = line[4*x+3]
+		}
+	}
+
+	return nil
+}
+
+// fromNV12 splits the luma plane and the interleaved chroma plane into a 4:2:0 image
+func (i *rawEncoder) fromNV12(raw []byte) error {
+	chromaOffset := i.stride * i.height
+	if len(raw) < chromaOffset+i.stride*(i.height/2-1)+i.width {
+		return errors.Errorf("truncated NV12 frame: %d bytes", len(raw))
+	}
+
+	img := i.image
+	for y := 0; y < i.height; y++ {
+		copy(img.Y[y*img.YStride:y*img.YStride+i.width], raw[y*i.stride:])
+	}
+
+	for y := 0; y < i.height/2; y++ {
+		line := raw[chromaOffset+y*i.stride:]
+		cRow := y * img.CStride
+
+		for x := 0; x < i.width/2; x++ {
+			img.Cb[cRow+x] = line[2*x]
+			img.Cr[cRow+x] = line[2*x+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package camera
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NegotiateFormat(t *testing.T) {
+	cases := []struct {
+		name                 string
+		available            []uint32
+		requested            string
+		expected             uint32
+		expectError          bool
+		expectedErrorMessage string
+	}{
+		{
+			name:      "auto prefers mjpeg",
+			available: []uint32{PixelFormatYUYV, PixelFormatMJPEG},
+			requested: "",
+			expected:  PixelFormatMJPEG,
+		},
+		{
+			name:      "auto falls back to yuyv",
+			available: []uint32{PixelFormatNV12, PixelFormatYUYV},
+			requested: "auto",
+			expected:  PixelFormatYUYV,
+		},
+		{
+			name:      "auto falls back to nv12",
+			available: []uint32{PixelFormatNV12},
+			requested: "auto",
+			expected:  PixelFormatNV12,
+		},
+		{
+			name:      "explicit raw format",
+			available: []uint32{PixelFormatMJPEG, PixelFormatYUYV},
+			requested: "YUYV",
+			expected:  PixelFormatYUYV,
+		},
+		{
+			name:                 "explicit format not offered",
+			available:            []uint32{PixelFormatYUYV},
+			requested:            "mjpeg",
+			expectError:          true,
+			expectedErrorMessage: "no supported pixel format for \"mjpeg\" among [YUYV]",
+		},
+		{
+			name:                 "unknown format",
+			available:            []uint32{PixelFormatYUYV},
+			requested:            "h264",
+			expectError:          true,
+			expectedErrorMessage: "unknown pixel format \"h264\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			format, err := NegotiateFormat(c.available, c.requested)
+
+			if c.expectError {
+				assert.NotNil(tt, err)
+				assert.Equal(tt, c.expectedErrorMessage, err.Error(), "wrong error message")
+			} else {
+				assert.Nil(tt, err)
+				assert.Equal(tt, FourCC(c.expected), FourCC(format))
+			}
+		})
+	}
+}
+
+func Test_rawEncoder(t *testing.T) {
+	width, height := 16, 8
+
+	// mid grey: Y=128, neutral chroma
+	yuyv := bytes.Repeat([]byte{128}, width*height*2)
+	nv12 := bytes.Repeat([]byte{128}, width*height*3/2)
+
+	cases := []struct {
+		name        string
+		pixelFormat uint32
+		raw         []byte
+		expectError bool
+	}{
+		{
+			name:        "yuyv",
+			pixelFormat: PixelFormatYUYV,
+			raw:         yuyv,
+		},
+		{
+			name:        "nv12",
+			pixelFormat: PixelFormatNV12,
+			raw:         nv12,
+		},
+		{
+			name:        "truncated yuyv",
+			pixelFormat: PixelFormatYUYV,
+			raw:         yuyv[:len(yuyv)/2],
+			expectError: true,
+		},
+		{
+			name:        "truncated nv12",
+			pixelFormat: PixelFormatNV12,
+			raw:         nv12[:width*height],
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			encoder, err := newRawEncoder(c.pixelFormat, width, height, 0, 90)
+			assert.Nil(tt, err)
+
+			frame, err := encoder.Encode(c.raw)
+			if c.expectError {
+				assert.NotNil(tt, err)
+				return
+			}
+
+			assert.Nil(tt, err)
+
+			img, err := jpeg.Decode(bytes.NewReader(frame))
+			assert.Nil(tt, err)
+			assert.Equal(tt, width, img.Bounds().Dx())
+			assert.Equal(tt, height, img.Bounds().Dy())
+
+			r, g, b, _ := img.At(width/2, height/2).RGBA()
+			assert.InDelta(tt, 128, r>>8, 4)
+			assert.InDelta(tt, 128, g>>8, 4)
+			assert.InDelta(tt, 128, b>>8, 4)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package camera
+
+import "strings"
+
+var (
+	PixelFormatMJPEG = FourCCCode("MJPG")
+	PixelFormatJPEG  = FourCCCode("JPEG")
+	PixelFormatYUYV  = FourCCCode("YUYV")
+	PixelFormatNV12  = FourCCCode("NV12")
+)
+
+// FourCC returns the four character code of a V4L2 pixel format, e.g. "MJPG"
+func FourCC(pixelFormat uint32) string {
+	code := []byte{
+		byte(pixelFormat),
+		byte(pixelFormat >> 8),
+		byte(pixelFormat >> 16),
+		byte(pixelFormat >> 24),
+	}
+
+	return strings.TrimRight(string(code), " \x00")
+}
+
+// FourCCCode returns the V4L2 pixel format of a four character code
+func FourCCCode(code string) uint32 {
+	padded := []byte(code + "    ")
+
+	return uint32(padded[0]) | uint32(padded[1])<<8 | uint32(padded[2])<<16 | uint32(padded[3])<<24
+}
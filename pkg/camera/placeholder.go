@@ -0,0 +1,63 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+var placeholderBackgroundColor = color.RGBA{R: 0x30, G: 0x0a, B: 0x24, A: 0xff}
+
+// renderPlaceholder draws the frame shown to viewers while the device is offline
+func renderPlaceholder(options *api.CameraOption, since, now time.Time) (*api.Frame, error) {
+	width := options.CaptureWidth
+	height := options.CaptureHeight
+
+	if width <= 0 || height <= 0 {
+		return nil, errors.Errorf("invalid placeholder size %dx%d", width, height)
+	}
+
+	ttf, err := loadFont()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse font")
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(placeholderBackgroundColor), image.Point{}, draw.Src)
+
+	err = drawTextBox(rgba, ttf, float64(height)/16, []string{
+		options.Name,
+		"camera offline",
+		"since " + since.Format("15:04:05"),
+		now.Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add text")
+	}
+
+	quality := options.JPEGQuality
+	if quality <= 0 {
+		quality = api.DefaultJPEGQuality
+	}
+
+	data := new(bytes.Buffer)
+	err = jpeg.Encode(data, rgba, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	return &api.Frame{
+		Data:        data.Bytes(),
+		Timestamp:   now,
+		Width:       width,
+		Height:      height,
+		PixelFormat: FourCC(PixelFormatJPEG),
+		Placeholder: true,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package camera
+
+import (
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+)
+
+// sanitiseProcessor drops truncated or malformed device frames and adds missing
+// Huffman tables, corrupt frames are counted as errors of the stage
+type sanitiseProcessor struct{}
+
+func (i *sanitiseProcessor) Name() string {
+	return "sanitise"
+}
+
+func (i *sanitiseProcessor) Process(frame *api.Frame) (*api.Frame, error) {
+	if frame.Placeholder {
+		return frame, nil
+	}
+
+	data, err := mjpeg.Sanitise(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	sanitised := *frame
+	sanitised.Data = data
+
+	return &sanitised, nil
+}
+
+// transformProcessor rotates and flips frames in software,
+// as far as the device did not do it itself
+type transformProcessor struct {
+	camera *camera
+}
+
+func (i *transformProcessor) Name() string {
+	return "transform"
+}
+
+func (i *transformProcessor) Process(frame *api.Frame) (*api.Frame, error) {
+	if frame.Placeholder {
+		return frame, nil
+	}
+
+	plan := i.camera.softwareTransform(i.camera.device())
+	if plan.isIdentity() {
+		return frame, nil
+	}
+
+	return transformFrame(frame, plan, i.camera.quality())
+}
+
+// roiProcessor zooms on the region of interest in software
+// when the device does not crop itself
+type roiProcessor struct {
+	camera *camera
+}
+
+func (i *roiProcessor) Name() string {
+	return "roi"
+}
+
+func (i *roiProcessor) Process(frame *api.Frame) (*api.Frame, error) {
+	if frame.Placeholder {
+		return frame, nil
+	}
+
+	roi := i.camera.softwareROI(i.camera.device())
+	if roi == nil {
+		return frame, nil
+	}
+
+	return cropFrame(frame, roi, i.camera.quality())
+}
@@ -0,0 +1,79 @@
+package camera
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func NewRegistry(defaultName string) *registry {
+	instance := new(registry)
+
+	instance.defaultName = defaultName
+	instance.cameras = make(map[string]api.Camera)
+
+	return instance
+}
+
+var _ api.Registry = &registry{}
+
+type registry struct {
+	mutex       sync.RWMutex
+	defaultName string
+	cameras     map[string]api.Camera
+	names       []string
+}
+
+func (i *registry) Add(camera api.Camera) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, exists := i.cameras[camera.Name()]; exists {
+		return errors.Errorf("camera \"%s\" is already registered", camera.Name())
+	}
+
+	i.cameras[camera.Name()] = camera
+	i.names = append(i.names, camera.Name())
+
+	return nil
+}
+
+func (i *registry) Get(name string) (api.Camera, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	camera, exists := i.cameras[name]
+	if !exists {
+		return nil, errors.Errorf("unknown camera \"%s\"", name)
+	}
+
+	return camera, nil
+}
+
+// Default returns the camera registered under the default name,
+// or the first registered one if no default name was configured
+func (i *registry) Default() (api.Camera, error) {
+	i.mutex.RLock()
+	name := i.defaultName
+	if name == "" && len(i.names) > 0 {
+		name = i.names[0]
+	}
+	i.mutex.RUnlock()
+
+	if name == "" {
+		return nil, errors.New("no camera registered")
+	}
+
+	return i.Get(name)
+}
+
+func (i *registry) Names() []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	names := make([]string, len(i.names))
+	copy(names, i.names)
+
+	return names
+}
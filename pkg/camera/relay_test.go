@@ -0,0 +1,73 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+)
+
+func Test_Relay(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, 32, 16)), nil))
+	timestamp := time.Unix(1700000000, 0)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writer := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", fmt.Sprintf("multipart/x-mixed-replace; boundary=%s", writer.Boundary()))
+
+		// upstream sequences are missing on some parts
+		for _, sequence := range []string{"42", "", "7", "8"} {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Type", "image/jpeg")
+			header.Set(mjpeg.HeaderTimestamp, mjpeg.FormatTimestamp(timestamp))
+			if sequence != "" {
+				header.Set(mjpeg.HeaderSequence, sequence)
+			}
+
+			part, _ := writer.CreatePart(header)
+			part.Write(buffer.Bytes())
+		}
+		writer.Close()
+	}))
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	device, err := Relay(ctx, &api.CameraOption{Source: upstream.URL + "/stream"})
+	assert.NoError(t, err)
+
+	sequences := make([]uint32, 0)
+	for frame := range device.GetOutput() {
+		assert.Equal(t, 32, frame.Width)
+		assert.True(t, timestamp.Equal(frame.Timestamp))
+		sequences = append(sequences, frame.Sequence)
+	}
+
+	// the feed ends with the upstream stream so that the camera reconnects,
+	// frames are numbered locally
+	assert.Equal(t, []uint32{0, 1, 2, 3}, sequences)
+}
+
+func Test_Relay_NotMultipart(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer upstream.Close()
+
+	_, err := Relay(context.Background(), &api.CameraOption{Source: upstream.URL})
+	assert.Error(t, err)
+}
@@ -0,0 +1,389 @@
+package camera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"image/jpeg"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+)
+
+// replayMaximumDelay caps gaps between recorded frames,
+// a capture paused for hours is not replayed as such
+const replayMaximumDelay = 2 * time.Second
+
+type frameReader interface {
+	Next() (*api.Frame, error)
+}
+
+// recording reads the frames of a capture one after the other,
+// io.EOF marks the end of the capture
+type recording interface {
+	frameReader
+	Close() error
+}
+
+// Replay plays back a recorded capture: a multipart MJPEG stream as served
+// on /stream, concatenated JPEG images or a directory of numbered JPEG files.
+// Frames are emitted at their recorded timing when known, or at the frame rate
+// of the options. Without looping, the last frame is repeated once the end is reached
+func Replay(ctx context.Context, options *api.CameraOption) (*replay, error) {
+	instance := new(replay)
+
+	path, err := ReplayPath(options.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	instance.path = path
+	instance.frameRate = options.FrameRate
+	instance.loop = options.Loop
+	instance.output = make(chan *api.Frame, 2)
+
+	// the capture is read once up front so that a missing, unreadable
+	// or empty file is reported right away and retried with a backoff
+	err = checkRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	capture, err := openRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("replaying %s, loop %t", path, instance.loop)
+
+	ctx, instance.cancel = context.WithCancel(ctx)
+	go instance.run(ctx, capture)
+
+	return instance, nil
+}
+
+// ReplayPath extracts the local path of a file:// source
+func ReplayPath(source string) (string, error) {
+	location, err := url.Parse(source)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid replay source \"%s\"", source)
+	}
+
+	if location.Scheme != api.SourceFileScheme || location.Path == "" {
+		return "", errors.Errorf("replay source \"%s\" must be of the form file:///path", source)
+	}
+
+	if location.Host != "" && location.Host != "localhost" {
+		return "", errors.Errorf("replay source \"%s\" must be a local path", source)
+	}
+
+	return location.Path, nil
+}
+
+var _ api.Device = &replay{}
+
+type replay struct {
+	path      string
+	frameRate int
+	loop      bool
+	output    chan *api.Frame
+	cancel    context.CancelFunc
+}
+
+func (i *replay) GetOutput() <-chan *api.Frame {
+	return i.output
+}
+
+func (i *replay) Close() error {
+	i.cancel()
+	return nil
+}
+
+func (i *replay) run(ctx context.Context, capture recording) {
+	defer close(i.output)
+	defer func() {
+		capture.Close()
+	}()
+
+	interval := time.Second / time.Duration(api.DefaultFrameRate)
+	if i.frameRate > 0 {
+		interval = time.Second / time.Duration(i.frameRate)
+	}
+
+	var last *api.Frame
+	var previous time.Time
+	sequence := uint32(0)
+	next := time.Now()
+	played := 0
+
+	for {
+		frame, err := capture.Next()
+		// a capture cut while recording ends with a truncated frame
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			if !i.loop {
+				log.Info().Msgf("end of replay %s", i.path)
+				i.repeat(ctx, last, sequence, interval)
+				return
+			}
+
+			// a capture emptied since it was opened would be reopened in a tight
+			// loop, the feed ends instead and the camera retries with a backoff
+			if played == 0 {
+				log.Error().Msgf("replay %s: no frame in capture", i.path)
+				return
+			}
+
+			capture.Close()
+			capture, err = openRecording(i.path)
+			if err != nil {
+				log.Error().Msgf("failed to restart replay: %s", err)
+				return
+			}
+
+			previous = time.Time{}
+			played = 0
+			continue
+		}
+
+		if err != nil {
+			log.Error().Msgf("replay %s: %s", i.path, err)
+			return
+		}
+
+		// recorded timing is only used without an explicit frame rate
+		delay := interval
+		if i.frameRate <= 0 && !previous.IsZero() && !frame.Timestamp.IsZero() {
+			delay = min(max(frame.Timestamp.Sub(previous), 0), replayMaximumDelay)
+		}
+		previous = frame.Timestamp
+		next = next.Add(delay)
+
+		if !i.sleep(ctx, next) {
+			return
+		}
+
+		frame.Timestamp = time.Now()
+		frame.Sequence = sequence
+		describeJPEG(frame)
+		sequence = sequence + 1
+		played = played + 1
+		last = frame
+
+		select {
+		case i.output <- frame:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkRecording makes sure that the capture holds at least one frame
+func checkRecording(path string) error {
+	capture, err := openRecording(path)
+	if err != nil {
+		return err
+	}
+	defer capture.Close()
+
+	_, err = capture.Next()
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.Errorf("replay %s: no frame in capture", path)
+	}
+
+	return errors.Wrapf(err, "replay %s", path)
+}
+
+// repeat keeps the last frame on screen once a capture without looping ended
+func (i *replay) repeat(ctx context.Context, last *api.Frame, sequence uint32, interval time.Duration) {
+	if last == nil {
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			frame := *last
+			frame.Timestamp = now
+			frame.Sequence = sequence
+			sequence = sequence + 1
+
+			select {
+			case i.output <- &frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (i *replay) sleep(ctx context.Context, deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// describeJPEG reads the frame size from the JPEG header
+func describeJPEG(frame *api.Frame) {
+	frame.PixelFormat = FourCC(PixelFormatJPEG)
+
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(frame.Data)); err == nil {
+		frame.Width = config.Width
+		frame.Height = config.Height
+	}
+}
+
+// openRecording detects the capture type: a directory of JPEG files,
+// a file starting with a JPEG image or a multipart stream
+func openRecording(path string) (recording, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open replay source")
+	}
+
+	if info.IsDir() {
+		return openDirectory(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open replay source")
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	start, _ := reader.Peek(2)
+	if bytes.Equal(start, []byte{0xff, 0xd8}) {
+		return &fileRecording{frameReader: &jpegReader{reader: reader}, file: file}, nil
+	}
+
+	boundary, err := mjpeg.DetectBoundary(reader)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "%s is neither a JPEG nor a multipart capture", path)
+	}
+
+	return &fileRecording{frameReader: mjpeg.NewMultipartReader(reader, boundary), file: file}, nil
+}
+
+type fileRecording struct {
+	frameReader
+	file io.Closer
+}
+
+func (i *fileRecording) Close() error {
+	return i.file.Close()
+}
+
+// jpegReader splits concatenated JPEG images
+type jpegReader struct {
+	reader *bufio.Reader
+}
+
+func (i *jpegReader) Next() (*api.Frame, error) {
+	data, err := mjpeg.ReadJPEG(i.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.Frame{Data: data}, nil
+}
+
+var frameNumber = regexp.MustCompile(`(\d+)\D*$`)
+
+// openDirectory lists the JPEG files of a directory in numerical order,
+// "frame-2.jpg" comes before "frame-10.jpg"
+func openDirectory(path string) (recording, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list replay directory")
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (extension != ".jpg" && extension != ".jpeg") {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+
+	if len(files) == 0 {
+		return nil, errors.Errorf("no JPEG file found in %s", path)
+	}
+
+	sort.SliceStable(files, func(a, b int) bool {
+		return lessNumbered(files[a], files[b])
+	})
+
+	return &jpegDirectory{path: path, files: files}, nil
+}
+
+func lessNumbered(a, b string) bool {
+	numberA, okA := fileNumber(a)
+	numberB, okB := fileNumber(b)
+
+	if okA && okB && numberA != numberB {
+		return numberA < numberB
+	}
+
+	return a < b
+}
+
+func fileNumber(name string) (uint64, bool) {
+	match := frameNumber.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name)))
+	if match == nil {
+		return 0, false
+	}
+
+	number, err := strconv.ParseUint(match[1], 10, 64)
+	return number, err == nil
+}
+
+type jpegDirectory struct {
+	path  string
+	files []string
+	index int
+}
+
+func (i *jpegDirectory) Next() (*api.Frame, error) {
+	if i.index >= len(i.files) {
+		return nil, io.EOF
+	}
+
+	name := i.files[i.index]
+	i.index = i.index + 1
+
+	data, err := os.ReadFile(filepath.Join(i.path, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", name)
+	}
+
+	return &api.Frame{Data: data}, nil
+}
+
+func (i *jpegDirectory) Close() error {
+	return nil
+}
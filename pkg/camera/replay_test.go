@@ -0,0 +1,106 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_ReplayPath(t *testing.T) {
+	path, err := ReplayPath("file:///captures/field.mjpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "/captures/field.mjpeg", path)
+
+	_, err = ReplayPath("file://remote/field.mjpeg")
+	assert.Error(t, err)
+
+	_, err = ReplayPath("http://camera/stream")
+	assert.Error(t, err)
+}
+
+func Test_lessNumbered(t *testing.T) {
+	assert.True(t, lessNumbered("frame-2.jpg", "frame-10.jpg"))
+	assert.False(t, lessNumbered("frame-10.jpg", "frame-2.jpg"))
+	assert.True(t, lessNumbered("a.jpg", "b.jpg"))
+}
+
+func Test_ReplayDirectory(t *testing.T) {
+	directory := t.TempDir()
+
+	for index, width := range map[int]int{1: 16, 2: 24, 10: 32} {
+		buffer := new(bytes.Buffer)
+		assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, width, 8)), nil))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, fmt.Sprintf("frame-%d.jpg", index)), buffer.Bytes(), 0644))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	device, err := Replay(ctx, &api.CameraOption{Source: "file://" + directory, FrameRate: 100})
+	assert.NoError(t, err)
+
+	widths := make([]int, 0)
+	timeout := time.After(time.Second)
+	for len(widths) < 5 {
+		select {
+		case frame := <-device.GetOutput():
+			widths = append(widths, frame.Width)
+		case <-timeout:
+			t.Fatal("no frame replayed")
+		}
+	}
+
+	// the last frame is repeated once the directory was played
+	assert.Equal(t, []int{16, 24, 32, 32, 32}, widths)
+}
+
+func Test_ReplayEmptyCapture(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	directory := t.TempDir()
+	empty := filepath.Join(directory, "empty.mjpeg")
+	truncated := filepath.Join(directory, "truncated.mjpeg")
+	assert.NoError(t, os.WriteFile(empty, nil, 0644))
+	assert.NoError(t, os.WriteFile(truncated, []byte{0xff, 0xd8, 0xff}, 0644))
+
+	for _, path := range []string{empty, truncated} {
+		_, err := Replay(ctx, &api.CameraOption{Source: "file://" + path, Loop: true})
+		assert.Error(t, err, path)
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, 16, 8)), nil))
+	capture := filepath.Join(directory, "capture.mjpeg")
+	assert.NoError(t, os.WriteFile(capture, buffer.Bytes(), 0644))
+
+	device, err := Replay(ctx, &api.CameraOption{Source: "file://" + capture, FrameRate: 100, Loop: true})
+	assert.NoError(t, err)
+
+	// a capture emptied while looping ends the feed instead of being reopened forever
+	assert.NoError(t, os.WriteFile(capture, []byte{0xff, 0xd8, 0xff}, 0644))
+
+	frames := 0
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-device.GetOutput():
+			if !ok {
+				assert.LessOrEqual(t, frames, 2)
+				return
+			}
+			frames = frames + 1
+		case <-timeout:
+			t.Fatal("replay of an empty capture did not end")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"golang.org/x/image/draw"
+)
+
+// FitSize computes the size of a downscaled frame fitting within width x height,
+// the aspect ratio is kept, a missing dimension is unbounded and frames are never upscaled
+func FitSize(frameWidth, frameHeight, width, height int) (int, int) {
+	if frameWidth <= 0 || frameHeight <= 0 {
+		return width, height
+	}
+
+	if width <= 0 || width > frameWidth {
+		width = frameWidth
+	}
+
+	if height <= 0 || height > frameHeight {
+		height = frameHeight
+	}
+
+	if width*frameHeight > height*frameWidth {
+		width = max(height*frameWidth/frameHeight, 1)
+	} else {
+		height = max(width*frameHeight/frameWidth, 1)
+	}
+
+	return width, height
+}
+
+// ResizeFrame decodes the JPEG frame and encodes it again at the given size and quality
+func ResizeFrame(frame *api.Frame, width, height, quality int) (*api.Frame, error) {
+	src, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode jpeg")
+	}
+
+	bounds := src.Bounds()
+	width, height = FitSize(bounds.Dx(), bounds.Dy(), width, height)
+
+	dst := src
+	if width != bounds.Dx() || height != bounds.Dy() {
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), src, bounds, draw.Src, nil)
+		dst = scaled
+	}
+
+	data := new(bytes.Buffer)
+	err = jpeg.Encode(data, dst, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	resized := *frame
+	resized.Data = data.Bytes()
+	resized.Width = width
+	resized.Height = height
+
+	return &resized, nil
+}
@@ -0,0 +1,107 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
+)
+
+func Test_FitSize(t *testing.T) {
+	cases := []struct {
+		name           string
+		width          int
+		height         int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "width only", width: 320, expectedWidth: 320, expectedHeight: 180},
+		{name: "height only", height: 90, expectedWidth: 160, expectedHeight: 90},
+		{name: "box keeps aspect ratio", width: 320, height: 320, expectedWidth: 320, expectedHeight: 180},
+		{name: "never upscaled", width: 3840, expectedWidth: 1280, expectedHeight: 720},
+		{name: "unbounded", expectedWidth: 1280, expectedHeight: 720},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			width, height := FitSize(1280, 720, c.width, c.height)
+			assert.Equal(tt, c.expectedWidth, width)
+			assert.Equal(tt, c.expectedHeight, height)
+		})
+	}
+}
+
+func testFrame(t *testing.T, width, height int) *api.Frame {
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, width, height)), nil))
+
+	return &api.Frame{Data: buffer.Bytes(), Width: width, Height: height, Sequence: 7}
+}
+
+func Test_ResizeFrame(t *testing.T) {
+	frame, err := ResizeFrame(testFrame(t, 640, 480), 160, 0, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, 160, frame.Width)
+	assert.Equal(t, 120, frame.Height)
+	assert.Equal(t, uint32(7), frame.Sequence)
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(frame.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, 160, config.Width)
+	assert.Equal(t, 120, config.Height)
+}
+
+// countingBroadcaster tracks the active subscriptions of the sub stream encoder
+type countingBroadcaster struct {
+	api.Broadcaster
+	active atomic.Int32
+}
+
+func (i *countingBroadcaster) Subscribe(ctx context.Context) <-chan *api.Frame {
+	i.active.Add(1)
+	go func() {
+		<-ctx.Done()
+		i.active.Add(-1)
+	}()
+
+	return i.Broadcaster.Subscribe(ctx)
+}
+
+func Test_subStreamEncodesOnlyWhileSubscribed(t *testing.T) {
+	source := make(chan *api.Frame)
+	main := &countingBroadcaster{Broadcaster: broadcast.New(context.Background(), source)}
+	sub := newSubStream(context.Background(), "test", main, &api.CameraOption{SubWidth: 32})
+
+	assert.Equal(t, int32(0), main.active.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	frames := sub.Subscribe(ctx)
+	second, cancelSecond := context.WithCancel(context.Background())
+	sub.Subscribe(second)
+
+	frame := testFrame(t, 64, 48)
+	deadline := time.After(time.Second)
+	for received := false; !received; {
+		select {
+		case source <- frame:
+		case resized := <-frames:
+			assert.Equal(t, 32, resized.Width)
+			assert.Equal(t, 24, resized.Height)
+			received = true
+		case <-deadline:
+			t.Fatal("timeout while waiting for a resized frame")
+		}
+	}
+	assert.Equal(t, int32(1), main.active.Load(), "a single encoder serves all subscribers")
+
+	cancel()
+	cancelSecond()
+	assert.Eventually(t, func() bool { return main.active.Load() == 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,33 @@
+package camera
+
+import (
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// SupportsFrameSize checks a resolution against discrete sizes
+// and stepwise or continuous ranges
+func SupportsFrameSize(sizes []*api.FrameSizeInfo, width, height int) bool {
+	for _, size := range sizes {
+		switch size.Type {
+		case api.SizeTypeDiscrete:
+			if size.Width == width && size.Height == height {
+				return true
+			}
+		default:
+			if inRange(width, size.MinWidth, size.MaxWidth, size.StepWidth) &&
+				inRange(height, size.MinHeight, size.MaxHeight, size.StepHeight) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func inRange(value, minimum, maximum, step int) bool {
+	if value < minimum || value > maximum {
+		return false
+	}
+
+	return step <= 1 || (value-minimum)%step == 0
+}
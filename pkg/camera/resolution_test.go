@@ -0,0 +1,85 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_SupportsFrameSize(t *testing.T) {
+	discrete := []*api.FrameSizeInfo{
+		{Type: api.SizeTypeDiscrete, Width: 640, Height: 480},
+		{Type: api.SizeTypeDiscrete, Width: 1920, Height: 1080},
+	}
+	stepwise := []*api.FrameSizeInfo{
+		{Type: api.SizeTypeStepwise, MinWidth: 32, MaxWidth: 2592, StepWidth: 2, MinHeight: 32, MaxHeight: 1944, StepHeight: 2},
+	}
+
+	cases := []struct {
+		name     string
+		sizes    []*api.FrameSizeInfo
+		width    int
+		height   int
+		expected bool
+	}{
+		{name: "discrete match", sizes: discrete, width: 1920, height: 1080, expected: true},
+		{name: "discrete mismatch", sizes: discrete, width: 1280, height: 720, expected: false},
+		{name: "stepwise match", sizes: stepwise, width: 1296, height: 972, expected: true},
+		{name: "stepwise off step", sizes: stepwise, width: 1295, height: 972, expected: false},
+		{name: "stepwise too large", sizes: stepwise, width: 3280, height: 2464, expected: false},
+		{name: "no sizes", sizes: nil, width: 640, height: 480, expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			assert.Equal(tt, c.expected, SupportsFrameSize(c.sizes, c.width, c.height))
+		})
+	}
+}
+
+func Test_CameraSetResolution(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bars, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateRunning, waitForState(bars, api.CameraStateRunning))
+
+	resolution, err := bars.Resolution()
+	assert.NoError(t, err)
+	assert.Equal(t, 64, resolution.Width)
+	assert.Equal(t, 48, resolution.Height)
+	assert.ErrorIs(t, bars.SetResolution(1, 1), api.ErrorInvalidResolution)
+
+	directory := t.TempDir()
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, 32, 16)), nil))
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "frame-1.jpg"), buffer.Bytes(), 0644))
+
+	replay, err := New(ctx, &api.CameraOption{
+		Name:           "field",
+		Source:         "file://" + directory,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateRunning, waitForState(replay, api.CameraStateRunning))
+
+	// replayed frames keep their recorded size
+	assert.ErrorIs(t, replay.SetResolution(640, 480), api.ErrorUnsupported)
+	assert.Equal(t, 64, replay.Options().CaptureWidth)
+}
@@ -0,0 +1,80 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"golang.org/x/image/draw"
+)
+
+// ValidateROI checks that the region of interest is not empty
+// and lies within the frame
+func ValidateROI(roi *api.ROI) error {
+	if roi == nil {
+		return nil
+	}
+
+	if roi.Width <= 0 || roi.Height <= 0 {
+		return errors.Errorf("region of interest must have a positive size, got %gx%g", roi.Width, roi.Height)
+	}
+
+	if roi.X < 0 || roi.Y < 0 || roi.X+roi.Width > 1 || roi.Y+roi.Height > 1 {
+		return errors.Errorf("region of interest %g,%g %gx%g exceeds the frame", roi.X, roi.Y, roi.Width, roi.Height)
+	}
+
+	return nil
+}
+
+// IsFullFrame reports whether the region of interest covers the whole frame
+func IsFullFrame(roi *api.ROI) bool {
+	return roi == nil || (roi.X <= 0 && roi.Y <= 0 && roi.Width >= 1 && roi.Height >= 1)
+}
+
+// roiRectangle converts the region of interest to pixels within the given bounds,
+// the result is never empty
+func roiRectangle(roi *api.ROI, bounds image.Rectangle) image.Rectangle {
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	rect := image.Rect(
+		int(roi.X*float64(width)),
+		int(roi.Y*float64(height)),
+		int((roi.X+roi.Width)*float64(width)),
+		int((roi.Y+roi.Height)*float64(height)),
+	)
+	rect.Min.X = min(rect.Min.X, width-1)
+	rect.Min.Y = min(rect.Min.Y, height-1)
+	rect.Max.X = max(rect.Max.X, rect.Min.X+1)
+	rect.Max.Y = max(rect.Max.Y, rect.Min.Y+1)
+
+	return rect.Add(bounds.Min).Intersect(bounds)
+}
+
+// cropFrame is the software fallback of the hardware crop: the region of interest
+// is cut out of the JPEG frame and scaled back to the frame size
+func cropFrame(frame *api.Frame, roi *api.ROI, quality int) (*api.Frame, error) {
+	src, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode jpeg")
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, roiRectangle(roi, bounds), draw.Src, nil)
+
+	data := new(bytes.Buffer)
+	err = jpeg.Encode(data, dst, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	cropped := *frame
+	cropped.Data = data.Bytes()
+	cropped.Width = bounds.Dx()
+	cropped.Height = bounds.Dy()
+
+	return &cropped, nil
+}
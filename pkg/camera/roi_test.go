@@ -0,0 +1,43 @@
+package camera
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_ValidateROI(t *testing.T) {
+	cases := []struct {
+		name        string
+		roi         *api.ROI
+		expectError bool
+	}{
+		{name: "nil", roi: nil},
+		{name: "full frame", roi: &api.ROI{Width: 1, Height: 1}},
+		{name: "centered quarter", roi: &api.ROI{X: 0.25, Y: 0.25, Width: 0.5, Height: 0.5}},
+		{name: "empty", roi: &api.ROI{X: 0.5, Y: 0.5}, expectError: true},
+		{name: "negative offset", roi: &api.ROI{X: -0.1, Width: 0.5, Height: 0.5}, expectError: true},
+		{name: "exceeding", roi: &api.ROI{X: 0.75, Width: 0.5, Height: 0.5}, expectError: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			err := ValidateROI(c.roi)
+			if c.expectError {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+			}
+		})
+	}
+}
+
+func Test_roiRectangle(t *testing.T) {
+	bounds := image.Rect(0, 0, 640, 480)
+
+	assert.Equal(t, image.Rect(160, 120, 480, 360), roiRectangle(&api.ROI{X: 0.25, Y: 0.25, Width: 0.5, Height: 0.5}, bounds))
+	assert.Equal(t, image.Rect(639, 479, 640, 480), roiRectangle(&api.ROI{X: 1, Y: 1}, bounds), "never empty")
+	assert.Equal(t, image.Rect(10, 20, 650, 500), roiRectangle(&api.ROI{Width: 1, Height: 1}, bounds.Add(image.Pt(10, 20))))
+}
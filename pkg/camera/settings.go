@@ -0,0 +1,138 @@
+package camera
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/filesystem"
+)
+
+// settings holds the camera values changed at runtime
+// which have to survive a device reopening or a restart
+type settings struct {
+	Controls map[uint32]int32 `json:"controls,omitempty"`
+	ROI      *api.ROI         `json:"roi,omitempty"`
+}
+
+func settingsPath(options *api.CameraOption) string {
+	return filepath.Join(options.StateDirectory, options.Name+".json")
+}
+
+// loadSettings merges persisted settings into the camera options
+func loadSettings(options *api.CameraOption) error {
+	if options.Controls == nil {
+		options.Controls = make(map[uint32]int32)
+	}
+
+	if options.StateDirectory == "" {
+		return nil
+	}
+
+	path := settingsPath(options)
+	exists, _, err := filesystem.FileExists(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check settings file %s", path)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read settings file %s", path)
+	}
+
+	persisted := new(settings)
+	err = json.Unmarshal(content, persisted)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse settings file %s", path)
+	}
+
+	for id, value := range persisted.Controls {
+		options.Controls[id] = value
+	}
+
+	if persisted.ROI != nil {
+		options.ROI = persisted.ROI
+	}
+
+	return nil
+}
+
+// persist applies a change to the camera options and saves them. The file is written
+// from a copy once the options are unlocked, saves are serialised so that the last
+// change is the one ending up on disk
+func (i *camera) persist(change func(options *api.CameraOption)) error {
+	i.saving.Lock()
+	defer i.saving.Unlock()
+
+	i.mutex.Lock()
+	change(i.options)
+	options := copyOptions(i.options)
+	i.mutex.Unlock()
+
+	return saveSettings(options)
+}
+
+func saveSettings(options *api.CameraOption) error {
+	if options.StateDirectory == "" {
+		return nil
+	}
+
+	err := filesystem.EnsureDirectory(options.StateDirectory)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create state directory")
+	}
+
+	persisted := &settings{
+		Controls: options.Controls,
+		ROI:      options.ROI,
+	}
+
+	content, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialise settings of camera \"%s\"", options.Name)
+	}
+
+	path := settingsPath(options)
+	err = writeFileAtomic(path, content)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write settings file %s", path)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file which replaces the target once synced,
+// an interrupted write never leaves a truncated file behind
+func writeFileAtomic(path string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,53 @@
+package camera
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_CameraPersistedSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	directory := t.TempDir()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: directory,
+	})
+	assert.NoError(t, err)
+
+	var group sync.WaitGroup
+	for index := range 8 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			offset := float64(index) / 10
+			assert.NoError(t, cam.SetROI(&api.ROI{X: offset, Y: offset, Width: 0.2, Height: 0.2}))
+		}()
+	}
+	group.Wait()
+
+	// the last change is the one written
+	persisted := &api.CameraOption{Name: "bars", StateDirectory: directory}
+	assert.NoError(t, loadSettings(persisted))
+	assert.Equal(t, cam.ROI(), persisted.ROI)
+
+	// nothing is written without state directory
+	volatile, err := New(ctx, &api.CameraOption{
+		Name:          "volatile",
+		Source:        api.SourceTestPattern,
+		CaptureWidth:  64,
+		CaptureHeight: 48,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, volatile.SetROI(&api.ROI{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5}))
+	assert.Equal(t, 0.5, volatile.ROI().X)
+}
@@ -0,0 +1,53 @@
+package camera
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_CameraSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+	})
+	assert.NoError(t, err)
+
+	frame, err := cam.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.False(t, frame.Placeholder)
+	assert.NotEmpty(t, frame.Data)
+}
+
+func Test_CameraSnapshotOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "missing",
+		Source:         api.SourceV4L2,
+		Device:         filepath.Join(t.TempDir(), "video0"),
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+	})
+	assert.NoError(t, err)
+
+	// placeholder frames are sent every second while offline
+	request, cancelRequest := context.WithTimeout(ctx, 2*placeholderInterval+500*time.Millisecond)
+	defer cancelRequest()
+
+	frame, err := cam.Snapshot(request)
+	assert.Nil(t, frame, "placeholders are not served as snapshots")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,59 @@
+package camera
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// Device opens the frame source selected in the camera options
+func Device(ctx context.Context, options *api.CameraOption) (api.Device, error) {
+	switch options.Source {
+	case "", api.SourceV4L2:
+		return V4L2(ctx, options)
+	case api.SourceTestPattern:
+		return TestPattern(ctx, options)
+	}
+
+	if isReplay(options.Source) {
+		return Replay(ctx, options)
+	}
+
+	if isRelay(options.Source) {
+		return Relay(ctx, options)
+	}
+
+	return nil, errors.Errorf("unknown camera source \"%s\"", options.Source)
+}
+
+// validateSource rejects unknown sources before any attempt to open them,
+// configuration errors must not be retried like an unplugged device
+func validateSource(source string) error {
+	switch source {
+	case "", api.SourceV4L2, api.SourceTestPattern:
+		return nil
+	}
+
+	if isReplay(source) {
+		_, err := ReplayPath(source)
+		return err
+	}
+
+	if isRelay(source) {
+		_, err := url.Parse(source)
+		return errors.Wrapf(err, "invalid relay source")
+	}
+
+	return errors.Errorf("unknown camera source \"%s\"", source)
+}
+
+func isReplay(source string) bool {
+	return strings.HasPrefix(source, api.SourceFileScheme+"://")
+}
+
+func isRelay(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
@@ -0,0 +1,119 @@
+package camera
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// State returns the requested state, a running camera without an open device
+// is reported idle when nobody watches and offline otherwise
+func (i *camera) State() string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.state == api.CameraStateRunning && i.idle {
+		return api.CameraStateIdle
+	}
+
+	if i.state == api.CameraStateRunning && i.v4l2 == nil {
+		return api.CameraStateOffline
+	}
+
+	return i.state
+}
+
+func (i *camera) Start() error {
+	i.transition.Lock()
+	defer i.transition.Unlock()
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	switch i.state {
+	case api.CameraStateRunning:
+		return nil
+	case api.CameraStatePaused:
+		return errors.Wrapf(api.ErrorInvalidState, "camera \"%s\" is paused", i.Name())
+	}
+
+	if i.ctx.Err() != nil {
+		return errors.Wrapf(i.ctx.Err(), "camera \"%s\" is shut down", i.Name())
+	}
+
+	ctx, cancel := context.WithCancel(i.ctx)
+	i.cancel = cancel
+	i.done = make(chan struct{})
+	i.state = api.CameraStateRunning
+
+	go func(done chan struct{}) {
+		defer close(done)
+		i.supervise(ctx)
+	}(i.done)
+
+	log.Info().Msgf("camera \"%s\" started", i.Name())
+
+	return nil
+}
+
+// Stop waits for the device to be closed so that
+// other tools can open it as soon as the call returns
+func (i *camera) Stop() error {
+	i.transition.Lock()
+	defer i.transition.Unlock()
+
+	i.mutex.Lock()
+	if i.state == api.CameraStateStopped {
+		i.mutex.Unlock()
+		return nil
+	}
+
+	cancel := i.cancel
+	done := i.done
+	i.state = api.CameraStateStopped
+	i.mutex.Unlock()
+
+	cancel()
+	<-done
+
+	log.Info().Msgf("camera \"%s\" stopped", i.Name())
+
+	return nil
+}
+
+func (i *camera) Pause() error {
+	return i.switchState(api.CameraStateRunning, api.CameraStatePaused)
+}
+
+func (i *camera) Resume() error {
+	return i.switchState(api.CameraStatePaused, api.CameraStateRunning)
+}
+
+// switchState moves between running and paused, the device stays open
+func (i *camera) switchState(from, to string) error {
+	i.transition.Lock()
+	defer i.transition.Unlock()
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	switch i.state {
+	case to:
+		return nil
+	case from:
+		i.state = to
+		log.Info().Msgf("camera \"%s\" %s", i.Name(), to)
+		return nil
+	default:
+		return errors.Wrapf(api.ErrorInvalidState, "camera \"%s\" is %s", i.Name(), i.state)
+	}
+}
+
+func (i *camera) paused() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.state == api.CameraStatePaused
+}
@@ -0,0 +1,54 @@
+package camera
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_CameraStateTransitions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cam, err := New(ctx, &api.CameraOption{
+		Name:           "bars",
+		Source:         api.SourceTestPattern,
+		CaptureWidth:   64,
+		CaptureHeight:  48,
+		StateDirectory: t.TempDir(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, api.CameraStateRunning, waitForState(cam, api.CameraStateRunning))
+
+	assert.NoError(t, cam.Pause())
+	assert.Equal(t, api.CameraStatePaused, cam.State())
+	assert.ErrorIs(t, cam.Start(), api.ErrorInvalidState)
+
+	assert.NoError(t, cam.Resume())
+	assert.NoError(t, cam.Resume(), "resuming a running camera is a no-op")
+
+	assert.NoError(t, cam.Stop())
+	assert.Equal(t, api.CameraStateStopped, cam.State())
+	assert.ErrorIs(t, cam.Pause(), api.ErrorInvalidState)
+	assert.ErrorIs(t, cam.Resume(), api.ErrorInvalidState)
+
+	assert.NoError(t, cam.Start())
+	frame, ok := <-cam.Subscribe(ctx)
+	assert.True(t, ok)
+	assert.NotEmpty(t, frame.Data)
+}
+
+// waitForState returns the state once it matches or after the device had time to open
+func waitForState(cam *camera, state string) string {
+	for range 100 {
+		if current := cam.State(); current == state {
+			return current
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return cam.State()
+}
@@ -0,0 +1,107 @@
+package camera
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
+)
+
+// newSubStream downscales the frames of the source, frames are
+// only encoded while at least one subscriber is connected
+func newSubStream(ctx context.Context, name string, source api.Broadcaster, options *api.CameraOption) *subStream {
+	instance := new(subStream)
+
+	instance.ctx = ctx
+	instance.name = name
+	instance.source = source
+	instance.width = options.SubWidth
+	instance.height = options.SubHeight
+	instance.quality = options.SubQuality
+	instance.resized = make(chan *api.Frame, 2)
+	instance.broadcaster = broadcast.New(ctx, instance.resized)
+
+	if instance.quality <= 0 {
+		instance.quality = api.DefaultSubQuality
+	}
+
+	if instance.width <= 0 && instance.height <= 0 {
+		instance.width = api.DefaultSubWidth
+	}
+
+	return instance
+}
+
+var _ api.SubStream = &subStream{}
+
+type subStream struct {
+	ctx         context.Context
+	name        string
+	source      api.Broadcaster
+	width       int
+	height      int
+	quality     int
+	mutex       sync.Mutex
+	subscribers int
+	cancel      context.CancelFunc
+	resized     chan *api.Frame
+	broadcaster api.Broadcaster
+}
+
+// Subscribe starts the encoder for the first subscriber,
+// it stops again when the last one leaves
+func (i *subStream) Subscribe(ctx context.Context) <-chan *api.Frame {
+	frames := i.broadcaster.Subscribe(ctx)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.subscribers = i.subscribers + 1
+	if i.subscribers == 1 {
+		var encoderCtx context.Context
+		encoderCtx, i.cancel = context.WithCancel(i.ctx)
+		go i.encode(encoderCtx)
+		log.Debug().Msgf("camera \"%s\": sub stream encoder started", i.name)
+	}
+
+	go func() {
+		<-ctx.Done()
+		i.unsubscribe()
+	}()
+
+	return frames
+}
+
+func (i *subStream) unsubscribe() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.subscribers = i.subscribers - 1
+	if i.subscribers == 0 {
+		i.cancel()
+		log.Debug().Msgf("camera \"%s\": sub stream encoder stopped", i.name)
+	}
+}
+
+func (i *subStream) encode(ctx context.Context) {
+	for frame := range i.source.Subscribe(ctx) {
+		resized, err := ResizeFrame(frame, i.width, i.height, i.quality)
+		if err != nil {
+			log.Debug().Msgf("camera \"%s\": failed to resize frame %d: %s", i.name, frame.Sequence, err)
+			continue
+		}
+
+		select {
+		case i.resized <- resized:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Resize downscales a single frame to the sub stream size
+func (i *subStream) Resize(frame *api.Frame) (*api.Frame, error) {
+	return ResizeFrame(frame, i.width, i.height, i.quality)
+}
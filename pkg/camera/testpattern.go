@@ -0,0 +1,229 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+const (
+	testPatternMinimumSize = 16
+	testPatternMaximumSize = 4096
+)
+
+var (
+	// 75% SMPTE color bars
+	smpteBars = []color.RGBA{
+		{R: 0xbf, G: 0xbf, B: 0xbf, A: 0xff},
+		{R: 0xbf, G: 0xbf, B: 0x00, A: 0xff},
+		{R: 0x00, G: 0xbf, B: 0xbf, A: 0xff},
+		{R: 0x00, G: 0xbf, B: 0x00, A: 0xff},
+		{R: 0xbf, G: 0x00, B: 0xbf, A: 0xff},
+		{R: 0xbf, G: 0x00, B: 0x00, A: 0xff},
+		{R: 0x00, G: 0x00, B: 0xbf, A: 0xff},
+	}
+	// reversed blue bars shown below the main bars
+	smpteCastellations = []color.RGBA{
+		{R: 0x00, G: 0x00, B: 0xbf, A: 0xff},
+		{R: 0x13, G: 0x13, B: 0x13, A: 0xff},
+		{R: 0xbf, G: 0x00, B: 0xbf, A: 0xff},
+		{R: 0x13, G: 0x13, B: 0x13, A: 0xff},
+		{R: 0x00, G: 0xbf, B: 0xbf, A: 0xff},
+		{R: 0x13, G: 0x13, B: 0x13, A: 0xff},
+		{R: 0xbf, G: 0xbf, B: 0xbf, A: 0xff},
+	}
+)
+
+// TestPattern generates SMPTE color bars with a moving gradient,
+// a frame counter and the current time, it does not require any hardware
+func TestPattern(ctx context.Context, options *api.CameraOption) (*testPattern, error) {
+	instance := new(testPattern)
+
+	instance.name = options.Name
+	instance.width = options.CaptureWidth
+	instance.height = options.CaptureHeight
+	instance.frameRate = options.FrameRate
+	instance.quality = options.JPEGQuality
+	instance.output = make(chan *api.Frame, 2)
+
+	if instance.width <= 0 || instance.height <= 0 {
+		return nil, errors.Errorf("invalid test pattern size %dx%d", instance.width, instance.height)
+	}
+
+	if instance.frameRate <= 0 {
+		instance.frameRate = api.DefaultFrameRate
+	}
+
+	if instance.quality <= 0 {
+		instance.quality = api.DefaultJPEGQuality
+	}
+
+	ttf, err := loadFont()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse font")
+	}
+
+	instance.font = ttf
+	instance.fontSize = float64(instance.height) / 16
+	instance.bars = instance.drawBars()
+
+	log.Info().Msgf("test pattern %dx%d at %d fps", instance.width, instance.height, instance.frameRate)
+
+	ctx, instance.cancel = context.WithCancel(ctx)
+	go instance.run(ctx)
+
+	return instance, nil
+}
+
+var _ api.SizingDevice = &testPattern{}
+
+type testPattern struct {
+	name      string
+	width     int
+	height    int
+	frameRate int
+	quality   int
+	output    chan *api.Frame
+	bars      *image.RGBA
+	font      *truetype.Font
+	fontSize  float64
+	cancel    context.CancelFunc
+}
+
+func (i *testPattern) GetOutput() <-chan *api.Frame {
+	return i.output
+}
+
+// FrameSizes bounds the generated resolution, any size in between can be rendered
+func (i *testPattern) FrameSizes() ([]*api.FrameSizeInfo, error) {
+	return []*api.FrameSizeInfo{{
+		Type:       api.SizeTypeContinuous,
+		MinWidth:   testPatternMinimumSize,
+		MaxWidth:   testPatternMaximumSize,
+		StepWidth:  1,
+		MinHeight:  testPatternMinimumSize,
+		MaxHeight:  testPatternMaximumSize,
+		StepHeight: 1,
+	}}, nil
+}
+
+func (i *testPattern) Size() (int, int) {
+	return i.width, i.height
+}
+
+func (i *testPattern) Close() error {
+	i.cancel()
+	return nil
+}
+
+func (i *testPattern) run(ctx context.Context) {
+	defer close(i.output)
+
+	ticker := time.NewTicker(time.Second / time.Duration(i.frameRate))
+	defer ticker.Stop()
+
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			data, err := i.render(count, now)
+			if err != nil {
+				log.Error().Msgf("failed to render test pattern frame %d: %s", count, err)
+				continue
+			}
+
+			frame := &api.Frame{
+				Data:        data,
+				Timestamp:   now,
+				Sequence:    uint32(count),
+				Width:       i.width,
+				Height:      i.height,
+				PixelFormat: FourCC(PixelFormatJPEG),
+			}
+
+			select {
+			case i.output <- frame:
+			case <-ctx.Done():
+				return
+			}
+
+			count = count + 1
+		}
+	}
+}
+
+// drawBars renders the static part of the pattern: the color bars
+// on the upper two thirds and the castellations right below
+func (i *testPattern) drawBars() *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, i.width, i.height))
+
+	barsBottom := i.height * 2 / 3
+	castellationsBottom := i.height * 3 / 4
+
+	for index := range smpteBars {
+		left := index * i.width / len(smpteBars)
+		right := (index + 1) * i.width / len(smpteBars)
+
+		draw.Draw(rgba, image.Rect(left, 0, right, barsBottom), image.NewUniform(smpteBars[index]), image.Point{}, draw.Src)
+		draw.Draw(rgba, image.Rect(left, barsBottom, right, castellationsBottom), image.NewUniform(smpteCastellations[index]), image.Point{}, draw.Src)
+	}
+
+	return rgba
+}
+
+func (i *testPattern) render(count int, now time.Time) ([]byte, error) {
+	rgba := image.NewRGBA(i.bars.Bounds())
+	copy(rgba.Pix, i.bars.Pix)
+
+	i.drawGradient(rgba, count)
+
+	err := drawTextBox(rgba, i.font, i.fontSize, []string{
+		i.name,
+		fmt.Sprintf("frame %06d", count),
+		now.Format("2006-01-02 15:04:05.000"),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add text")
+	}
+
+	frame := new(bytes.Buffer)
+	err = jpeg.Encode(frame, rgba, &jpeg.Options{Quality: i.quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	return frame.Bytes(), nil
+}
+
+// drawGradient fills the lower quarter with a gradient scrolling one step per frame,
+// a frozen gradient means the pipeline stalls
+func (i *testPattern) drawGradient(rgba *image.RGBA, count int) {
+	top := i.height * 3 / 4
+	bandHeight := i.height - top
+
+	for x := 0; x < i.width; x++ {
+		position := (x + count*4) % i.width
+		level := uint8(position * 0xff / i.width)
+
+		for y := top; y < i.height; y++ {
+			vertical := uint8((y - top) * 0xff / bandHeight)
+			offset := rgba.PixOffset(x, y)
+			rgba.Pix[offset] = level
+			rgba.Pix[offset+1] = 0xff - level
+			rgba.Pix[offset+2] = vertical
+			rgba.Pix[offset+3] = 0xff
+		}
+	}
+}
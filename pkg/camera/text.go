@@ -0,0 +1,72 @@
+package camera
+
+import (
+	_ "embed"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+//go:embed UbuntuMono-R.ttf
+var ttfBytes []byte
+
+var (
+	textColor           = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	textBackgroundColor = color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff}
+)
+
+var (
+	parseFontOnce sync.Once
+	parsedFont    *truetype.Font
+	parseFontErr  error
+)
+
+// loadFont parses the embedded font once, the parsed font is shared
+func loadFont() (*truetype.Font, error) {
+	parseFontOnce.Do(func() {
+		parsedFont, parseFontErr = freetype.ParseFont(ttfBytes)
+	})
+
+	return parsedFont, parseFontErr
+}
+
+// drawTextBox writes lines of text on a black box in the upper left corner
+func drawTextBox(rgba *image.RGBA, ttf *truetype.Font, fontSize float64, lines []string) error {
+	text := freetype.NewContext()
+	text.SetDPI(72)
+	text.SetFont(ttf)
+	text.SetFontSize(fontSize)
+	text.SetClip(rgba.Bounds())
+	text.SetDst(rgba)
+	text.SetSrc(image.NewUniform(textColor))
+	text.SetHinting(font.HintingNone)
+
+	lineHeight := int(text.PointToFixed(fontSize*1.3) >> 6) // Note shift/truncate 6 bits first
+	margin := lineHeight / 2
+
+	// monospace font: characters are roughly half as wide as high
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len(line))
+	}
+	boxWidth := longest*int(fontSize)/2 + 2*margin
+	boxHeight := len(lines)*lineHeight + margin
+
+	draw.Draw(rgba, image.Rect(margin, margin, margin+boxWidth, margin+boxHeight), image.NewUniform(textBackgroundColor), image.Point{}, draw.Src)
+
+	pt := freetype.Pt(2*margin, margin+lineHeight)
+	for _, line := range lines {
+		_, err := text.DrawString(line, pt)
+		if err != nil {
+			return err
+		}
+		pt.Y += text.PointToFixed(fontSize * 1.3)
+	}
+
+	return nil
+}
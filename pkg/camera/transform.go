@@ -0,0 +1,191 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// transform is the normalised form of a rotation followed by flips:
+// the input is flipped first, then rotated clockwise by a quarter turn when set.
+// Flips of the input can be delegated to the sensor, the quarter turn cannot
+type transform struct {
+	hflip   bool
+	vflip   bool
+	quarter bool
+}
+
+// ValidateRotation accepts clockwise rotations by quarter turns
+func ValidateRotation(rotation int) error {
+	switch rotation {
+	case 0, 90, 180, 270:
+		return nil
+	default:
+		return errors.Errorf("rotation must be 0, 90, 180 or 270 degrees, got %d", rotation)
+	}
+}
+
+// planTransform converts the configured rotation and output flips.
+// A half turn is both flips, three quarters are a quarter and a half turn,
+// and an output flip after a quarter turn is the other flip of the input
+func planTransform(options *api.CameraOption) transform {
+	plan := transform{hflip: options.HorizontalFlip, vflip: options.VerticalFlip}
+
+	switch options.Rotation {
+	case 90:
+		plan = transform{hflip: plan.vflip, vflip: plan.hflip, quarter: true}
+	case 180:
+		plan = transform{hflip: !plan.hflip, vflip: !plan.vflip}
+	case 270:
+		plan = transform{hflip: !plan.vflip, vflip: !plan.hflip, quarter: true}
+	}
+
+	return plan
+}
+
+func (i transform) isIdentity() bool {
+	return !i.hflip && !i.vflip && !i.quarter
+}
+
+// transformFrame decodes the JPEG frame, applies the transform and encodes it again
+func transformFrame(frame *api.Frame, plan transform, quality int) (*api.Frame, error) {
+	src, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode jpeg")
+	}
+
+	var dst image.Image
+	if ycbcr, ok := src.(*image.YCbCr); ok && transformableRatio(ycbcr.SubsampleRatio, plan) {
+		dst = transformYCbCr(ycbcr, plan)
+	} else {
+		dst = transformImage(src, plan)
+	}
+
+	data := new(bytes.Buffer)
+	err = jpeg.Encode(data, dst, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode jpeg")
+	}
+
+	transformed := *frame
+	transformed.Data = data.Bytes()
+	transformed.Width = dst.Bounds().Dx()
+	transformed.Height = dst.Bounds().Dy()
+
+	return &transformed, nil
+}
+
+// transformableRatio reports whether the chroma subsampling has a rotated equivalent
+func transformableRatio(ratio image.YCbCrSubsampleRatio, plan transform) bool {
+	switch ratio {
+	case image.YCbCrSubsampleRatio444, image.YCbCrSubsampleRatio420, image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio440:
+		return true
+	default:
+		return !plan.quarter
+	}
+}
+
+func rotatedRatio(ratio image.YCbCrSubsampleRatio) image.YCbCrSubsampleRatio {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return image.YCbCrSubsampleRatio440
+	case image.YCbCrSubsampleRatio440:
+		return image.YCbCrSubsampleRatio422
+	default:
+		return ratio
+	}
+}
+
+// transformYCbCr works on the planes directly, avoiding any color conversion
+func transformYCbCr(src *image.YCbCr, plan transform) *image.YCbCr {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	ratio := src.SubsampleRatio
+
+	if plan.quarter {
+		width, height = height, width
+		ratio = rotatedRatio(ratio)
+	}
+
+	dst := image.NewYCbCr(image.Rect(0, 0, width, height), ratio)
+
+	lumaWidth, lumaHeight := bounds.Dx(), bounds.Dy()
+	transformPlane(src.Y[src.YOffset(bounds.Min.X, bounds.Min.Y):], src.YStride, lumaWidth, lumaHeight, dst.Y, dst.YStride, plan)
+
+	chromaWidth, chromaHeight := chromaSize(src.SubsampleRatio, lumaWidth, lumaHeight)
+	offset := src.COffset(bounds.Min.X, bounds.Min.Y)
+	transformPlane(src.Cb[offset:], src.CStride, chromaWidth, chromaHeight, dst.Cb, dst.CStride, plan)
+	transformPlane(src.Cr[offset:], src.CStride, chromaWidth, chromaHeight, dst.Cr, dst.CStride, plan)
+
+	return dst
+}
+
+func chromaSize(ratio image.YCbCrSubsampleRatio, width, height int) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return (width + 1) / 2, height
+	case image.YCbCrSubsampleRatio420:
+		return (width + 1) / 2, (height + 1) / 2
+	case image.YCbCrSubsampleRatio440:
+		return width, (height + 1) / 2
+	case image.YCbCrSubsampleRatio411:
+		return (width + 3) / 4, height
+	case image.YCbCrSubsampleRatio410:
+		return (width + 3) / 4, (height + 1) / 2
+	default:
+		return width, height
+	}
+}
+
+// transformPlane copies a width x height plane, flipping then rotating it
+func transformPlane(src []byte, srcStride, width, height int, dst []byte, dstStride int, plan transform) {
+	for y := 0; y < height; y++ {
+		row := src[y*srcStride : y*srcStride+width]
+
+		for x, value := range row {
+			dx, dy := transformPoint(x, y, width, height, plan)
+			dst[dy*dstStride+dx] = value
+		}
+	}
+}
+
+// transformPoint maps a source position to its position in the transformed image
+func transformPoint(x, y, width, height int, plan transform) (int, int) {
+	if plan.hflip {
+		x = width - 1 - x
+	}
+
+	if plan.vflip {
+		y = height - 1 - y
+	}
+
+	if plan.quarter {
+		return height - 1 - y, x
+	}
+
+	return x, y
+}
+
+// transformImage is the generic fallback for uncommon image types
+func transformImage(src image.Image, plan transform) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	size := image.Rect(0, 0, width, height)
+	if plan.quarter {
+		size = image.Rect(0, 0, height, width)
+	}
+
+	dst := image.NewRGBA(size)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := transformPoint(x, y, width, height, plan)
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,79 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_planTransform(t *testing.T) {
+	cases := []struct {
+		name     string
+		options  *api.CameraOption
+		expected transform
+	}{
+		{name: "none", options: &api.CameraOption{}, expected: transform{}},
+		{name: "mirror", options: &api.CameraOption{HorizontalFlip: true}, expected: transform{hflip: true}},
+		{name: "upside down", options: &api.CameraOption{Rotation: 180}, expected: transform{hflip: true, vflip: true}},
+		{name: "upside down mirrored", options: &api.CameraOption{Rotation: 180, HorizontalFlip: true}, expected: transform{vflip: true}},
+		{name: "quarter", options: &api.CameraOption{Rotation: 90}, expected: transform{quarter: true}},
+		{name: "quarter mirrored", options: &api.CameraOption{Rotation: 90, HorizontalFlip: true}, expected: transform{vflip: true, quarter: true}},
+		{name: "three quarters", options: &api.CameraOption{Rotation: 270}, expected: transform{hflip: true, vflip: true, quarter: true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			assert.Equal(tt, c.expected, planTransform(c.options))
+		})
+	}
+}
+
+// Test_transformPoint checks the plans against the rotation they stand for
+// on the corners of a 4x2 image
+func Test_transformPoint(t *testing.T) {
+	// clockwise quarter turn: top left goes to top right
+	x, y := transformPoint(0, 0, 4, 2, planTransform(&api.CameraOption{Rotation: 90}))
+	assert.Equal(t, []int{1, 0}, []int{x, y})
+
+	// three quarters: top left goes to bottom left
+	x, y = transformPoint(0, 0, 4, 2, planTransform(&api.CameraOption{Rotation: 270}))
+	assert.Equal(t, []int{0, 3}, []int{x, y})
+
+	// quarter turn then mirror: top left stays top left
+	x, y = transformPoint(0, 0, 4, 2, planTransform(&api.CameraOption{Rotation: 90, HorizontalFlip: true}))
+	assert.Equal(t, []int{0, 0}, []int{x, y})
+
+	// half turn: top left goes to bottom right
+	x, y = transformPoint(0, 0, 4, 2, planTransform(&api.CameraOption{Rotation: 180}))
+	assert.Equal(t, []int{3, 1}, []int{x, y})
+}
+
+func Test_transformFrame(t *testing.T) {
+	// white left half, black right half
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	draw.Draw(src, image.Rect(0, 0, 32, 32), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(32, 0, 64, 32), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, src, nil))
+
+	frame, err := transformFrame(&api.Frame{Data: buffer.Bytes(), Width: 64, Height: 32}, transform{quarter: true}, 90)
+	assert.NoError(t, err)
+	assert.Equal(t, 32, frame.Width)
+	assert.Equal(t, 64, frame.Height)
+
+	decoded, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	assert.NoError(t, err)
+
+	// the left half ends up on top
+	top, _, _, _ := decoded.At(16, 8).RGBA()
+	bottom, _, _, _ := decoded.At(16, 56).RGBA()
+	assert.Greater(t, top, uint32(0xe000))
+	assert.Less(t, bottom, uint32(0x2000))
+}
@@ -4,6 +4,7 @@ package camera
 
 import (
 	"context"
+	"image"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -12,18 +13,10 @@ import (
 	"github.com/ylallemant/go-picam-streamer/pkg/api"
 )
 
-func Device(ctx context.Context, options *api.CameraOption) (*device.Device, error) {
-	cam, err := device.Open(
-		api.DefaultDevice,
-		//device.WithPixFormat(v4l2.PixFormat{PixelFormat: v4l2.PixelFmtMJPEG, Width: 640, Height: 480}),
-		device.WithPixFormat(v4l2.PixFormat{
-			PixelFormat: v4l2.PixelFmtMJPEG,
-			Width:       options.CaptureWidth,
-			Height:      options.CaptureHeight,
-		}),
-	)
+func V4L2(ctx context.Context, options *api.CameraOption) (*v4l2Device, error) {
+	cam, err := device.Open(options.Device)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open camera device %s", api.DefaultDevice)
+		return nil, errors.Wrapf(err, "failed to open camera device %s", options.Device)
 	}
 
 	log.Info().Msgf("device name:            %s", cam.Name())
@@ -31,9 +24,378 @@ func Device(ctx context.Context, options *api.CameraOption) (*device.Device, err
 	log.Info().Msgf("device capability:      %s", cam.Capability())
 	log.Info().Msgf("device buffer type:     %v", cam.BufferType())
 
-	if err := cam.Start(ctx); err != nil {
-		log.Fatal().Msgf("camera start: %s", err)
+	instance := new(v4l2Device)
+	instance.device = cam
+	instance.stream = &stream{Device: cam}
+
+	pixFormat, err := instance.negotiateFormat(options)
+	if err != nil {
+		cam.Close()
+		return nil, errors.Wrapf(err, "failed to set format of camera device %s", options.Device)
+	}
+
+	// the region of interest is relative to the transformed image,
+	// the sensor coordinates only match without transform
+	plan := planTransform(options)
+	roi := options.ROI
+	if !plan.isIdentity() {
+		roi = nil
+	}
+
+	pixFormat, err = instance.crop(roi, pixFormat)
+	if err != nil {
+		cam.Close()
+		return nil, errors.Wrapf(err, "failed to read format of camera device %s", options.Device)
+	}
+
+	log.Info().Msgf("device pixel format:    %s", pixFormat)
+	instance.stream.format = pixFormat
+
+	if options.FrameRate > 0 {
+		// drivers without frame rate support capture at their default rate
+		err = cam.SetFrameRate(uint32(options.FrameRate))
+		if err != nil {
+			log.Warn().Msgf("failed to set frame rate of camera device %s to %d fps, using the driver default: %s", options.Device, options.FrameRate, err)
+		}
+	}
+
+	if param, err := cam.GetStreamParam(); err == nil {
+		log.Info().Msgf("device time per frame:  %d/%d s", param.Capture.TimePerFrame.Numerator, param.Capture.TimePerFrame.Denominator)
+	}
+
+	instance.applyControls(options.Controls)
+	instance.flip(plan)
+
+	var encoder *rawEncoder
+	if !IsCompressed(pixFormat.PixelFormat) {
+		encoder, err = newRawEncoder(
+			pixFormat.PixelFormat,
+			int(pixFormat.Width),
+			int(pixFormat.Height),
+			int(pixFormat.BytesPerLine),
+			options.JPEGQuality,
+		)
+		if err != nil {
+			cam.Close()
+			return nil, errors.Wrapf(err, "failed to initialise encoder of camera device %s", options.Device)
+		}
+	}
+
+	ctx, instance.cancel = context.WithCancel(ctx)
+
+	frames, err := instance.stream.Capture(ctx)
+	if err != nil {
+		instance.cancel()
+		cam.Close()
+		return nil, errors.Wrapf(err, "failed to start capture on camera device %s", options.Device)
+	}
+
+	instance.output = frames
+
+	if encoder != nil {
+		instance.output = encode(ctx, frames, encoder)
 	}
 
-	return cam, nil
+	return instance, nil
+}
+
+// negotiateFormat sets the preferred pixel format among the ones offered by the driver
+// and returns the format actually applied, the driver may adjust the resolution
+func (i *v4l2Device) negotiateFormat(options *api.CameraOption) (v4l2.PixFormat, error) {
+	descriptions, err := i.device.GetFormatDescriptions()
+	if len(descriptions) == 0 && err != nil {
+		return v4l2.PixFormat{}, errors.Wrap(err, "failed to list formats")
+	}
+
+	available := make([]uint32, 0, len(descriptions))
+	for _, description := range descriptions {
+		available = append(available, description.PixelFormat)
+	}
+
+	pixelFormat, err := NegotiateFormat(available, options.PixelFormat)
+	if err != nil {
+		return v4l2.PixFormat{}, err
+	}
+
+	err = i.device.SetPixFormat(v4l2.PixFormat{
+		PixelFormat: pixelFormat,
+		Width:       uint32(options.CaptureWidth),
+		Height:      uint32(options.CaptureHeight),
+		Field:       v4l2.FieldNone,
+	})
+	if err != nil {
+		return v4l2.PixFormat{}, err
+	}
+
+	return v4l2.GetPixFormat(i.device.Fd())
+}
+
+// flip delegates the flips of the transform to the sensor through the
+// HFLIP and VFLIP controls, the frames are flipped in software when it fails
+func (i *v4l2Device) flip(plan transform) {
+	i.flipped = flipSensor(i.device, plan)
+}
+
+// flipSensor writes both flip controls, also when no flip is planned so that flips
+// left on the sensor are cleared. Both are reset when one of them cannot be set
+func flipSensor(device sensor, plan transform) bool {
+	err := device.SetControlValue(v4l2.CtrlHFlip, flipValue(plan.hflip))
+	if err == nil {
+		err = device.SetControlValue(v4l2.CtrlVFlip, flipValue(plan.vflip))
+	}
+
+	if err != nil {
+		if plan.hflip || plan.vflip {
+			log.Info().Msgf("device %s: no hardware flip, flipping in software: %s", device.Name(), err)
+		}
+		device.SetControlValue(v4l2.CtrlHFlip, 0)
+		device.SetControlValue(v4l2.CtrlVFlip, 0)
+		return false
+	}
+
+	if plan.hflip || plan.vflip {
+		log.Info().Msgf("device flip:            horizontal %t, vertical %t", plan.hflip, plan.vflip)
+	}
+
+	return true
+}
+
+func flipValue(enabled bool) int32 {
+	if enabled {
+		return 1
+	}
+
+	return 0
+}
+
+// crop applies the region of interest on the sensor when the driver supports it,
+// the format is read again as drivers without scaler shrink the frame size
+func (i *v4l2Device) crop(roi *api.ROI, pixFormat v4l2.PixFormat) (v4l2.PixFormat, error) {
+	i.canCrop, i.cropped = cropSensor(i.device, roi)
+	if !i.canCrop {
+		return pixFormat, nil
+	}
+
+	return v4l2.GetPixFormat(i.device.Fd())
+}
+
+// sensor is the part of the device applying crops and flips
+type sensor interface {
+	Name() string
+	GetCropCapability() (v4l2.CropCapability, error)
+	SetCropRect(rect v4l2.Rect) error
+	SetControlValue(id v4l2.CtrlID, value v4l2.CtrlValue) error
+}
+
+// cropSensor crops the sensor to the region of interest. Crops persist across
+// reopen, the default rectangle is restored when no region is requested
+func cropSensor(device sensor, roi *api.ROI) (canCrop, cropped bool) {
+	capability, err := device.GetCropCapability()
+	if err != nil {
+		log.Debug().Msgf("device %s: no crop support: %s", device.Name(), err)
+		return false, false
+	}
+
+	if IsFullFrame(roi) {
+		err = device.SetCropRect(capability.DefaultRect)
+		if err != nil {
+			log.Warn().Msgf("device %s: failed to reset crop: %s", device.Name(), err)
+		}
+		return true, false
+	}
+
+	bounds := image.Rect(
+		int(capability.Bounds.Left),
+		int(capability.Bounds.Top),
+		int(capability.Bounds.Left)+int(capability.Bounds.Width),
+		int(capability.Bounds.Top)+int(capability.Bounds.Height),
+	)
+	rect := roiRectangle(roi, bounds)
+
+	err = device.SetCropRect(v4l2.Rect{
+		Left:   int32(rect.Min.X),
+		Top:    int32(rect.Min.Y),
+		Width:  uint32(rect.Dx()),
+		Height: uint32(rect.Dy()),
+	})
+	if err != nil {
+		log.Warn().Msgf("device %s: hardware crop failed, falling back to software: %s", device.Name(), err)
+		return false, false
+	}
+
+	log.Info().Msgf("device crop:            %s", rect)
+
+	return true, true
+}
+
+// encode converts raw device frames to JPEG images,
+// frames failing the conversion are dropped
+func encode(ctx context.Context, raw <-chan *api.Frame, encoder *rawEncoder) <-chan *api.Frame {
+	output := make(chan *api.Frame, 2)
+
+	go func() {
+		defer close(output)
+
+		for frame := range raw {
+			data, err := encoder.Encode(frame.Data)
+			if err != nil {
+				log.Debug().Msgf("dropped raw frame %d: %s", frame.Sequence, err)
+				continue
+			}
+
+			encoded := *frame
+			encoded.Data = data
+			encoded.PixelFormat = FourCC(PixelFormatJPEG)
+
+			select {
+			case output <- &encoded:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output
+}
+
+var _ api.ControllableDevice = &v4l2Device{}
+var _ api.CroppingDevice = &v4l2Device{}
+var _ api.SizingDevice = &v4l2Device{}
+var _ api.FlippingDevice = &v4l2Device{}
+
+type v4l2Device struct {
+	device  *device.Device
+	stream  *stream
+	output  <-chan *api.Frame
+	cancel  context.CancelFunc
+	canCrop bool
+	cropped bool
+	flipped bool
+}
+
+func (i *v4l2Device) GetOutput() <-chan *api.Frame {
+	return i.output
+}
+
+// FrameSizes lists the sizes supported with the negotiated pixel format
+func (i *v4l2Device) FrameSizes() ([]*api.FrameSizeInfo, error) {
+	sizes, err := v4l2.GetFormatFrameSizes(i.device.Fd(), i.stream.format.PixelFormat)
+	if len(sizes) == 0 && err != nil {
+		return nil, errors.Wrapf(err, "failed to query frame sizes of %s", i.device.Name())
+	}
+
+	infos := make([]*api.FrameSizeInfo, 0, len(sizes))
+	for _, size := range sizes {
+		infos = append(infos, describeFrameSize(i.device.Fd(), size))
+	}
+
+	return infos, nil
+}
+
+// Size returns the negotiated format, drivers adjust unsupported sizes
+// and crops shrink the frame on drivers without scaler
+func (i *v4l2Device) Size() (int, int) {
+	return int(i.stream.format.Width), int(i.stream.format.Height)
+}
+
+func (i *v4l2Device) Flipped() bool {
+	return i.flipped
+}
+
+func (i *v4l2Device) Cropped() bool {
+	return i.cropped
+}
+
+func (i *v4l2Device) CanCrop() bool {
+	return i.canCrop
+}
+
+// Close stops the capture loop and waits for it to release
+// the buffers before closing the file descriptor
+func (i *v4l2Device) Close() error {
+	i.cancel()
+	<-i.stream.done
+
+	return i.device.Close()
+}
+
+func (i *v4l2Device) Controls() ([]*api.Control, error) {
+	infos, err := i.device.QueryAllControls()
+	if len(infos) == 0 && err != nil {
+		return nil, errors.Wrapf(err, "failed to query controls of %s", i.device.Name())
+	}
+
+	controls := make([]*api.Control, 0, len(infos))
+	for _, info := range infos {
+		if info.Type == v4l2.CtrlTypeClass {
+			continue
+		}
+
+		control := &api.Control{
+			ID:      info.ID,
+			Name:    info.Name,
+			Key:     ControlKey(info.Name),
+			Type:    controlType(info.Type),
+			Minimum: info.Minimum,
+			Maximum: info.Maximum,
+			Step:    info.Step,
+			Default: info.Default,
+		}
+
+		// write-only controls like buttons have no value to read
+		if value, err := v4l2.GetControlValue(i.device.Fd(), info.ID); err == nil {
+			control.Value = value
+		}
+
+		if info.IsMenu() {
+			items, err := info.GetMenuItems()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to query menu of control \"%s\"", info.Name)
+			}
+
+			for _, item := range items {
+				control.Menu = append(control.Menu, &api.ControlMenuItem{
+					Index: item.Index,
+					Name:  item.Name,
+				})
+			}
+		}
+
+		controls = append(controls, control)
+	}
+
+	return controls, nil
+}
+
+func (i *v4l2Device) SetControl(id uint32, value int32) error {
+	return i.device.SetControlValue(id, value)
+}
+
+// applyControls restores persisted control values,
+// failures are only logged as the driver may have changed
+func (i *v4l2Device) applyControls(controls map[uint32]int32) {
+	for id, value := range controls {
+		if err := i.SetControl(id, value); err != nil {
+			log.Warn().Msgf("failed to restore control %d to %d: %s", id, value, err)
+			continue
+		}
+		log.Info().Msgf("restored control %d to %d", id, value)
+	}
+}
+
+func controlType(ctrlType v4l2.CtrlType) string {
+	switch ctrlType {
+	case v4l2.CtrlTypeInt:
+		return api.ControlTypeInteger
+	case v4l2.CtrlTypeBool:
+		return api.ControlTypeBoolean
+	case v4l2.CtrlTypeMenu:
+		return api.ControlTypeMenu
+	case v4l2.CtrlTypeIntegerMenu:
+		return api.ControlTypeIntegerMenu
+	case v4l2.CtrlTypeButton:
+		return api.ControlTypeButton
+	default:
+		return api.ControlTypeOther
+	}
 }
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package camera
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// V4L2 falls back to the test pattern, V4L2 devices only exist on Linux
+func V4L2(ctx context.Context, options *api.CameraOption) (api.Device, error) {
+	log.Warn().Msgf("V4L2 is not available on this platform, camera \"%s\" uses the test pattern", options.Name)
+	return TestPattern(ctx, options)
+}
@@ -0,0 +1,209 @@
+//go:build linux
+
+package camera
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/vladimirvivien/go4vl/device"
+	"github.com/vladimirvivien/go4vl/v4l2"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	sys "golang.org/x/sys/unix"
+)
+
+const (
+	streamBufferCount = 4
+	streamPollTimeout = 500 * time.Millisecond
+)
+
+// stream captures frames from memory mapped buffers. It replaces the go4vl
+// stream loop which drops the buffer metadata (timestamp, sequence)
+type stream struct {
+	*device.Device
+	bufferCount uint32
+	buffers     [][]byte
+	format      v4l2.PixFormat
+	dropped     uint64
+	done        chan struct{}
+}
+
+func (i *stream) BufferCount() uint32 {
+	return i.bufferCount
+}
+
+func (i *stream) Buffers() [][]byte {
+	return i.buffers
+}
+
+func (i *stream) Capture(ctx context.Context) (<-chan *api.Frame, error) {
+	i.bufferCount = streamBufferCount
+
+	request, err := v4l2.InitBuffers(i)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to request buffers")
+	}
+	i.bufferCount = request.Count
+
+	i.buffers, err = v4l2.MapMemoryBuffers(i)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to map buffers")
+	}
+
+	for index := uint32(0); index < i.bufferCount; index++ {
+		_, err := v4l2.QueueBuffer(i.Fd(), i.MemIOType(), i.BufferType(), index)
+		if err != nil {
+			i.release()
+			return nil, errors.Wrapf(err, "failed to queue buffer %d", index)
+		}
+	}
+
+	err = v4l2.StreamOn(i)
+	if err != nil {
+		i.release()
+		return nil, errors.Wrap(err, "failed to start streaming")
+	}
+
+	output := make(chan *api.Frame, 2)
+	i.done = make(chan struct{})
+	go i.run(ctx, output)
+
+	return output, nil
+}
+
+func (i *stream) run(ctx context.Context, output chan<- *api.Frame) {
+	defer close(i.done)
+	defer close(output)
+	defer i.release()
+
+	fd := i.Fd()
+	ioType := i.MemIOType()
+	bufType := i.BufferType()
+	pixelFormat := FourCC(i.format.PixelFormat)
+
+	var lastSequence uint32
+	first := true
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		ready, err := i.wait()
+		if err != nil {
+			log.Error().Msgf("device %s: %s", i.Name(), err)
+			return
+		}
+
+		if !ready {
+			continue
+		}
+
+		buffer, err := v4l2.DequeueBuffer(fd, ioType, bufType)
+		if err != nil {
+			if errors.Is(err, sys.EAGAIN) {
+				continue
+			}
+			log.Error().Msgf("device %s: failed to dequeue buffer: %s", i.Name(), err)
+			return
+		}
+
+		var frame *api.Frame
+		if buffer.Flags&v4l2.BufFlagError == 0 && buffer.BytesUsed > 0 {
+			frame = &api.Frame{
+				Data:        make([]byte, buffer.BytesUsed),
+				Timestamp:   wallClock(buffer.Timestamp),
+				Sequence:    buffer.Sequence,
+				Width:       int(i.format.Width),
+				Height:      int(i.format.Height),
+				PixelFormat: pixelFormat,
+			}
+			copy(frame.Data, i.buffers[buffer.Index][:buffer.BytesUsed])
+		}
+
+		_, err = v4l2.QueueBuffer(fd, ioType, bufType, buffer.Index)
+		if err != nil {
+			log.Error().Msgf("device %s: failed to queue buffer: %s", i.Name(), err)
+			return
+		}
+
+		// the driver increments the sequence for every captured frame,
+		// including the ones it could not hand over
+		if !first && buffer.Sequence > lastSequence+1 {
+			gap := uint64(buffer.Sequence - lastSequence - 1)
+			i.dropped = i.dropped + gap
+			log.Debug().Msgf("device %s: %d frames dropped before sequence %d (%d in total)", i.Name(), gap, buffer.Sequence, i.dropped)
+		}
+		lastSequence = buffer.Sequence
+		first = false
+
+		if frame == nil {
+			i.dropped = i.dropped + 1
+			continue
+		}
+
+		select {
+		case output <- frame:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// wait polls the device for a filled buffer, a timeout is not an error
+// so that the context gets checked regularly
+func (i *stream) wait() (bool, error) {
+	fds := []sys.PollFd{{Fd: int32(i.Fd()), Events: sys.POLLIN}}
+
+	count, err := sys.Poll(fds, int(streamPollTimeout/time.Millisecond))
+	if err != nil {
+		if errors.Is(err, sys.EINTR) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to poll device")
+	}
+
+	if count == 0 {
+		return false, nil
+	}
+
+	if fds[0].Revents&(sys.POLLERR|sys.POLLHUP|sys.POLLNVAL) != 0 {
+		return false, errors.Errorf("device reported poll events %#x", fds[0].Revents)
+	}
+
+	return true, nil
+}
+
+func (i *stream) release() {
+	if err := v4l2.StreamOff(i); err != nil {
+		log.Debug().Msgf("device %s: %s", i.Name(), err)
+	}
+
+	if i.buffers != nil {
+		if err := v4l2.UnmapMemoryBuffers(i); err != nil {
+			log.Debug().Msgf("device %s: %s", i.Name(), err)
+		}
+		i.buffers = nil
+	}
+
+	if _, err := v4l2.ResetBuffers(i); err != nil {
+		log.Debug().Msgf("device %s: %s", i.Name(), err)
+	}
+}
+
+// wallClock converts a monotonic buffer timestamp to wall clock time
+func wallClock(timestamp sys.Timeval) time.Time {
+	var monotonic sys.Timespec
+	if err := sys.ClockGettime(sys.CLOCK_MONOTONIC, &monotonic); err != nil {
+		return time.Now()
+	}
+
+	age := time.Duration(monotonic.Nano() - timestamp.Nano())
+	if age < 0 || timestamp.Sec == 0 {
+		return time.Now()
+	}
+
+	return time.Now().Add(-age)
+}
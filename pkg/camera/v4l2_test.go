@@ -0,0 +1,105 @@
+//go:build linux
+
+package camera
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vladimirvivien/go4vl/v4l2"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// fakeSensor keeps the crop and controls like a driver does across reopen
+type fakeSensor struct {
+	capability  v4l2.CropCapability
+	noCrop      bool
+	crop        v4l2.Rect
+	controls    map[v4l2.CtrlID]v4l2.CtrlValue
+	unsupported map[v4l2.CtrlID]bool
+}
+
+func newFakeSensor() *fakeSensor {
+	full := v4l2.Rect{Width: 1920, Height: 1080}
+
+	return &fakeSensor{
+		capability:  v4l2.CropCapability{Bounds: full, DefaultRect: full},
+		crop:        full,
+		controls:    make(map[v4l2.CtrlID]v4l2.CtrlValue),
+		unsupported: make(map[v4l2.CtrlID]bool),
+	}
+}
+
+func (i *fakeSensor) Name() string {
+	return "fake"
+}
+
+func (i *fakeSensor) GetCropCapability() (v4l2.CropCapability, error) {
+	if i.noCrop {
+		return v4l2.CropCapability{}, errors.New("not supported")
+	}
+
+	return i.capability, nil
+}
+
+func (i *fakeSensor) SetCropRect(rect v4l2.Rect) error {
+	i.crop = rect
+	return nil
+}
+
+func (i *fakeSensor) SetControlValue(id v4l2.CtrlID, value v4l2.CtrlValue) error {
+	if i.unsupported[id] {
+		return errors.New("not supported")
+	}
+
+	i.controls[id] = value
+	return nil
+}
+
+func Test_cropSensor(t *testing.T) {
+	sensor := newFakeSensor()
+
+	canCrop, cropped := cropSensor(sensor, &api.ROI{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5})
+	assert.True(t, canCrop)
+	assert.True(t, cropped)
+	assert.Equal(t, v4l2.Rect{Left: 960, Top: 540, Width: 960, Height: 540}, sensor.crop)
+
+	// the reset reopens the device, the crop kept by the driver is undone
+	canCrop, cropped = cropSensor(sensor, nil)
+	assert.True(t, canCrop)
+	assert.False(t, cropped)
+	assert.Equal(t, sensor.capability.DefaultRect, sensor.crop)
+
+	sensor.noCrop = true
+	canCrop, cropped = cropSensor(sensor, &api.ROI{X: 0, Y: 0, Width: 0.5, Height: 0.5})
+	assert.False(t, canCrop)
+	assert.False(t, cropped)
+}
+
+func Test_flipSensor(t *testing.T) {
+	sensor := newFakeSensor()
+
+	assert.True(t, flipSensor(sensor, transform{hflip: true, vflip: true}))
+	assert.Equal(t, v4l2.CtrlValue(1), sensor.controls[v4l2.CtrlHFlip])
+	assert.Equal(t, v4l2.CtrlValue(1), sensor.controls[v4l2.CtrlVFlip])
+
+	// flips left by a previous run are cleared
+	assert.True(t, flipSensor(sensor, transform{}))
+	assert.Equal(t, v4l2.CtrlValue(0), sensor.controls[v4l2.CtrlHFlip])
+	assert.Equal(t, v4l2.CtrlValue(0), sensor.controls[v4l2.CtrlVFlip])
+
+	// a sensor flipping only horizontally is flipped in software, nothing stays applied
+	partial := newFakeSensor()
+	partial.controls[v4l2.CtrlVFlip] = 1
+	partial.unsupported[v4l2.CtrlVFlip] = true
+	assert.False(t, flipSensor(partial, transform{hflip: true, vflip: true}))
+	assert.Equal(t, v4l2.CtrlValue(0), partial.controls[v4l2.CtrlHFlip])
+
+	// a vertical flip left on the sensor is cleared when the horizontal flip is unsupported
+	failing := newFakeSensor()
+	failing.controls[v4l2.CtrlVFlip] = 1
+	failing.unsupported[v4l2.CtrlHFlip] = true
+	assert.False(t, flipSensor(failing, transform{vflip: true}))
+	assert.Equal(t, v4l2.CtrlValue(0), failing.controls[v4l2.CtrlVFlip])
+}
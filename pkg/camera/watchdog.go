@@ -0,0 +1,188 @@
+package camera
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+const (
+	// a device delivering no frame for this long is considered dead,
+	// slow frame rates get at least a few frame intervals
+	stallTimeout        = 5 * time.Second
+	stallFrameIntervals = 5
+	// frames late by a few intervals mark the camera degraded
+	degradedMinimum        = 500 * time.Millisecond
+	degradedFrameIntervals = 3
+	watchdogInterval       = 200 * time.Millisecond
+	// weight of the last interval in the observed average
+	intervalWeight = 0.1
+)
+
+// ValidateStallRecovery checks the action taken on a stalled device
+func ValidateStallRecovery(recovery string) error {
+	switch recovery {
+	case "", api.StallRecoveryReopen, api.StallRecoveryExit:
+		return nil
+	default:
+		return errors.Errorf("stall recovery must be %s or %s, got \"%s\"", api.StallRecoveryReopen, api.StallRecoveryExit, recovery)
+	}
+}
+
+func newWatchdog(options *api.CameraOption) *watchdog {
+	instance := new(watchdog)
+	instance.frameRate = options.FrameRate
+	instance.timeout = options.StallTimeout
+	instance.recovery = options.StallRecovery
+
+	if instance.recovery == "" {
+		instance.recovery = api.StallRecoveryReopen
+	}
+
+	return instance
+}
+
+// watchdog tracks the time since the last frame of the open device
+// against the expected frame interval
+type watchdog struct {
+	mutex     sync.Mutex
+	frameRate int
+	timeout   time.Duration
+	recovery  string
+	armed     time.Time
+	lastFrame time.Time
+	// observed average interval, used when no frame rate is configured
+	interval time.Duration
+	degraded bool
+	stalls   uint64
+}
+
+// arm starts watching a freshly opened device
+func (i *watchdog) arm(now time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.armed = now
+	i.lastFrame = time.Time{}
+	i.degraded = false
+}
+
+func (i *watchdog) frame(now time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if !i.lastFrame.IsZero() {
+		interval := now.Sub(i.lastFrame)
+		if i.interval == 0 {
+			i.interval = interval
+		} else {
+			i.interval = time.Duration(intervalWeight*float64(interval) + (1-intervalWeight)*float64(i.interval))
+		}
+	}
+
+	i.lastFrame = now
+}
+
+// watchdogCheck is the outcome of a single check
+type watchdogCheck struct {
+	since    time.Duration
+	expected time.Duration
+	timeout  time.Duration
+	degraded bool
+	// changed reports that the degraded state differs from the previous check
+	changed bool
+	stalled bool
+}
+
+// check compares the delay since the last frame with the expected interval
+// and the stall timeout, every stall is counted
+func (i *watchdog) check(now time.Time) *watchdogCheck {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	result := &watchdogCheck{
+		since:    i.since(now),
+		expected: i.expectedInterval(),
+		timeout:  i.stallTimeout(),
+	}
+
+	result.degraded = result.since > i.degradedThreshold()
+	result.changed = result.degraded != i.degraded
+	result.stalled = result.since > result.timeout
+	i.degraded = result.degraded
+
+	if result.stalled {
+		i.stalls = i.stalls + 1
+	}
+
+	return result
+}
+
+// since is measured from the opening of the device until the first frame
+func (i *watchdog) since(now time.Time) time.Duration {
+	if i.lastFrame.IsZero() {
+		return now.Sub(i.armed)
+	}
+
+	return now.Sub(i.lastFrame)
+}
+
+func (i *watchdog) expectedInterval() time.Duration {
+	if i.frameRate > 0 {
+		return time.Second / time.Duration(i.frameRate)
+	}
+
+	if i.interval > 0 {
+		return i.interval
+	}
+
+	return time.Second / api.DefaultFrameRate
+}
+
+func (i *watchdog) degradedThreshold() time.Duration {
+	return max(degradedMinimum, degradedFrameIntervals*i.expectedInterval())
+}
+
+func (i *watchdog) stallTimeout() time.Duration {
+	timeout := stallTimeout
+	if i.timeout > 0 {
+		timeout = i.timeout
+	}
+
+	if i.frameRate <= 0 {
+		return timeout
+	}
+
+	return max(timeout, stallFrameIntervals*i.expectedInterval())
+}
+
+// health reports the watchdog view of an open device
+func (i *watchdog) health(now time.Time) *api.Health {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	health := &api.Health{
+		State:            api.HealthHealthy,
+		SinceLastFrame:   milliseconds(i.since(now)),
+		ExpectedInterval: milliseconds(i.expectedInterval()),
+		StallTimeout:     milliseconds(i.stallTimeout()),
+		Recovery:         i.recovery,
+		Stalls:           i.stalls,
+	}
+
+	if i.degraded {
+		health.State = api.HealthDegraded
+	}
+
+	if !i.lastFrame.IsZero() {
+		health.LastFrame = i.lastFrame.UTC().Format(time.RFC3339Nano)
+	}
+
+	return health
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,82 @@
+package camera
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_watchdogCheck(t *testing.T) {
+	start := time.Now()
+
+	cases := []struct {
+		name             string
+		options          *api.CameraOption
+		since            time.Duration
+		expectedDegraded bool
+		expectedStalled  bool
+	}{
+		{name: "on time", options: &api.CameraOption{FrameRate: 10}, since: 100 * time.Millisecond},
+		{name: "late", options: &api.CameraOption{FrameRate: 10}, since: time.Second, expectedDegraded: true},
+		{name: "stalled", options: &api.CameraOption{FrameRate: 10}, since: 6 * time.Second, expectedDegraded: true, expectedStalled: true},
+		{name: "slow frame rate", options: &api.CameraOption{FrameRate: 1}, since: 4 * time.Second, expectedDegraded: true},
+		{name: "configured timeout", options: &api.CameraOption{FrameRate: 10, StallTimeout: 2 * time.Second}, since: 3 * time.Second, expectedDegraded: true, expectedStalled: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			dog := newWatchdog(c.options)
+			dog.arm(start)
+			dog.frame(start)
+
+			check := dog.check(start.Add(c.since))
+			assert.Equal(tt, c.expectedDegraded, check.degraded)
+			assert.Equal(tt, c.expectedDegraded, check.changed)
+			assert.Equal(tt, c.expectedStalled, check.stalled)
+		})
+	}
+}
+
+func Test_watchdogObservedInterval(t *testing.T) {
+	start := time.Now()
+	dog := newWatchdog(&api.CameraOption{})
+	dog.arm(start)
+
+	for n := 0; n < 10; n++ {
+		dog.frame(start.Add(time.Duration(n) * 200 * time.Millisecond))
+	}
+
+	last := start.Add(1800 * time.Millisecond)
+	assert.Equal(t, 200*time.Millisecond, dog.expectedInterval())
+	assert.False(t, dog.check(last.Add(500*time.Millisecond)).degraded)
+	assert.True(t, dog.check(last.Add(1500*time.Millisecond)).degraded)
+
+	// a new frame clears the degraded state
+	dog.frame(last.Add(1600 * time.Millisecond))
+	check := dog.check(last.Add(1700 * time.Millisecond))
+	assert.False(t, check.degraded)
+	assert.True(t, check.changed)
+}
+
+func Test_watchdogHealth(t *testing.T) {
+	start := time.Now()
+	dog := newWatchdog(&api.CameraOption{FrameRate: 10})
+	dog.arm(start)
+
+	assert.True(t, dog.check(start.Add(6*time.Second)).stalled)
+
+	health := dog.health(start.Add(6 * time.Second))
+	assert.Equal(t, api.HealthDegraded, health.State)
+	assert.Equal(t, api.StallRecoveryReopen, health.Recovery)
+	assert.Equal(t, uint64(1), health.Stalls)
+	assert.Equal(t, float64(100), health.ExpectedInterval)
+	assert.Empty(t, health.LastFrame)
+}
+
+func Test_ValidateStallRecovery(t *testing.T) {
+	assert.NoError(t, ValidateStallRecovery(""))
+	assert.NoError(t, ValidateStallRecovery(api.StallRecoveryExit))
+	assert.Error(t, ValidateStallRecovery("restart"))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/ylallemant/go-picam-streamer/pkg/cli/binary/upgrade"
 	"github.com/ylallemant/go-picam-streamer/pkg/cli/binary/version"
+	"github.com/ylallemant/go-picam-streamer/pkg/cli/devices"
 	"github.com/ylallemant/go-picam-streamer/pkg/cli/start"
 )
 
@@ -25,6 +26,7 @@ func init() {
 	rootCmd.AddCommand(upgrade.Command())
 	rootCmd.AddCommand(version.Command())
 	rootCmd.AddCommand(start.Command())
+	rootCmd.AddCommand(devices.Command())
 }
 
 func Command() *cobra.Command {
@@ -0,0 +1,120 @@
+package devices
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+	"github.com/ylallemant/go-picam-streamer/pkg/cli/devices/options"
+	"github.com/ylallemant/go-picam-streamer/pkg/globals"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "lists V4L2 devices with their formats, resolutions and frame rates",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		globals.ProcessGlobals()
+
+		devices, err := camera.ListDevices()
+		if err != nil {
+			return errors.Wrap(err, "failed to list devices")
+		}
+
+		switch options.Current.Output {
+		case options.OutputJSON:
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(devices)
+		case options.OutputTable:
+			return printTable(os.Stdout, devices)
+		default:
+			return errors.Errorf("unknown output format \"%s\"", options.Current.Output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&options.Current.Output, "output", "o", options.Current.Output, "output format: table or json")
+	rootCmd.PersistentFlags().BoolVar(&globals.Current.Debug, "debug", globals.Current.Debug, "outputs processing information")
+}
+
+func Command() *cobra.Command {
+	pflag.CommandLine.AddFlagSet(rootCmd.Flags())
+	return rootCmd
+}
+
+func printTable(out io.Writer, devices []*api.DeviceInfo) error {
+	if len(devices) == 0 {
+		fmt.Fprintln(out, "no V4L2 device found")
+		return nil
+	}
+
+	for index, device := range devices {
+		if index > 0 {
+			fmt.Fprintln(out)
+		}
+
+		fmt.Fprintf(out, "%s\n", device.Path)
+		if device.Error != "" {
+			fmt.Fprintf(out, "  error:        %s\n", device.Error)
+		}
+		fmt.Fprintf(out, "  driver:       %s\n", device.Driver)
+		fmt.Fprintf(out, "  card:         %s\n", device.Card)
+		fmt.Fprintf(out, "  bus:          %s\n", device.BusInfo)
+		fmt.Fprintf(out, "  capabilities: %s\n", strings.Join(device.Capabilities, ", "))
+
+		if len(device.Formats) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(out)
+		table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "  FORMAT\tDESCRIPTION\tSIZE\tFRAME RATES")
+		for _, format := range device.Formats {
+			for _, size := range format.Sizes {
+				fmt.Fprintf(table, "  %s\t%s\t%s\t%s\n", format.PixelFormat, format.Description, formatSize(size), formatFrameRates(size.FrameRates))
+			}
+		}
+
+		if err := table.Flush(); err != nil {
+			return errors.Wrap(err, "failed to print device table")
+		}
+	}
+
+	return nil
+}
+
+func formatSize(size *api.FrameSizeInfo) string {
+	if size.Type == api.SizeTypeDiscrete {
+		return fmt.Sprintf("%dx%d", size.Width, size.Height)
+	}
+
+	return fmt.Sprintf("%dx%d - %dx%d (step %dx%d)", size.MinWidth, size.MinHeight, size.MaxWidth, size.MaxHeight, size.StepWidth, size.StepHeight)
+}
+
+func formatFrameRates(rates []*api.FrameRateInfo) string {
+	formatted := make([]string, 0, len(rates))
+
+	for _, rate := range rates {
+		if rate.Type == api.SizeTypeDiscrete {
+			formatted = append(formatted, fmt.Sprintf("%g", rate.FrameRate))
+		} else {
+			formatted = append(formatted, fmt.Sprintf("%g-%g", rate.MinFrameRate, rate.MaxFrameRate))
+		}
+	}
+
+	if len(formatted) == 0 {
+		return "-"
+	}
+
+	return strings.Join(formatted, ", ") + " fps"
+}
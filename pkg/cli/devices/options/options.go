@@ -0,0 +1,22 @@
+package options
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+var (
+	Current = NewOptions()
+)
+
+func NewOptions() *Options {
+	options := new(Options)
+
+	options.Output = OutputTable
+
+	return options
+}
+
+type Options struct {
+	Output string
+}
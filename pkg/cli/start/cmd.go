@@ -1,11 +1,17 @@
 package start
 
 import (
+	"context"
+	"os/signal"
+	"syscall"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
 	"github.com/ylallemant/go-picam-streamer/pkg/cli/start/options"
+	"github.com/ylallemant/go-picam-streamer/pkg/environment"
 	"github.com/ylallemant/go-picam-streamer/pkg/globals"
 	"github.com/ylallemant/go-picam-streamer/pkg/server"
 )
@@ -18,13 +24,55 @@ var rootCmd = &cobra.Command{
 		globals.ProcessGlobals()
 
 		serverOptions := &api.ServerOptions{
-			Port:    options.Current.Port,
-			Address: options.Current.Address,
+			Port:          options.Current.Port,
+			Address:       options.Current.Address,
+			DefaultCamera: options.Current.DefaultCamera,
+			RTSPPort:      options.Current.RTSPPort,
+		}
+
+		// nothing is persisted without state directory
+		stateDirectory := options.Current.StateDirectory
+		if stateDirectory != "" {
+			absolute, err := environment.EnsureAbsolutePath(stateDirectory)
+			if err != nil {
+				return errors.Wrap(err, "failed to resolve state directory")
+			}
+			stateDirectory = absolute
+		}
+
+		defaultCameraOptions := &api.CameraOption{
+			Name:           api.DefaultCameraName,
+			Source:         options.Current.Source,
+			Device:         options.Current.Device,
+			CaptureHeight:  options.Current.CaptureHeight,
+			CaptureWidth:   options.Current.CaptureWidth,
+			FrameRate:      options.Current.FrameRate,
+			PixelFormat:    options.Current.PixelFormat,
+			JPEGQuality:    options.Current.JPEGQuality,
+			Loop:           options.Current.Loop,
+			Rotation:       options.Current.Rotation,
+			HorizontalFlip: options.Current.HorizontalFlip,
+			VerticalFlip:   options.Current.VerticalFlip,
+			SubWidth:       options.Current.SubWidth,
+			SubHeight:      options.Current.SubHeight,
+			SubQuality:     options.Current.SubQuality,
+			StallTimeout:   options.Current.StallTimeout,
+			StallRecovery:  options.Current.StallRecovery,
+			IdleTimeout:    options.Current.IdleTimeout,
+			StateDirectory: stateDirectory,
+		}
+
+		cameraOptions := make([]*api.CameraOption, 0)
+		for _, definition := range options.Current.Cameras {
+			cameraOption, err := camera.ParseDefinition(definition, defaultCameraOptions)
+			if err != nil {
+				return errors.Wrap(err, "failed to parse camera definition")
+			}
+			cameraOptions = append(cameraOptions, cameraOption)
 		}
 
-		cameraOptions := &api.CameraOption{
-			CaptureHeight: options.Current.CaptureHeight,
-			CaptureWidth:  options.Current.CaptureWidth,
+		if len(cameraOptions) == 0 {
+			cameraOptions = append(cameraOptions, defaultCameraOptions)
 		}
 
 		srv, err := server.New(serverOptions, cameraOptions)
@@ -32,15 +80,59 @@ var rootCmd = &cobra.Command{
 			return errors.Wrap(err, "failed to start server")
 		}
 
-		return srv.Start()
+		signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.Start()
+		}()
+
+		select {
+		case err := <-served:
+			return err
+		case <-signals.Done():
+			// a second signal terminates immediately
+			stop()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), options.Current.ShutdownTimeout)
+		defer cancel()
+
+		err = srv.Shutdown(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to shut down server")
+		}
+
+		return <-served
 	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&options.Current.Address, "address", "a", options.Current.Address, "server listener address")
 	rootCmd.PersistentFlags().StringVarP(&options.Current.Port, "port", "p", options.Current.Port, "server listener port")
+	rootCmd.PersistentFlags().StringVar(&options.Current.RTSPPort, "rtsp-port", options.Current.RTSPPort, "RTSP listener port serving every camera as rtsp://<host>:<port>/<name>, disabled when empty")
+	rootCmd.PersistentFlags().DurationVar(&options.Current.ShutdownTimeout, "shutdown-timeout", options.Current.ShutdownTimeout, "time given to running requests on SIGINT or SIGTERM before they are cut off")
+	rootCmd.PersistentFlags().StringVar(&options.Current.Source, "source", options.Current.Source, "frame source of the default camera: v4l2, testpattern or file:///path of a recorded capture")
+	rootCmd.PersistentFlags().StringVarP(&options.Current.Device, "device", "d", options.Current.Device, "V4L2 device path of the default camera")
 	rootCmd.PersistentFlags().IntVarP(&options.Current.CaptureHeight, "camera-capture-height", "y", options.Current.CaptureHeight, "camera capture height in pixels")
 	rootCmd.PersistentFlags().IntVarP(&options.Current.CaptureWidth, "camera-capture-width", "w", options.Current.CaptureWidth, "camera capture width in pixels")
+	rootCmd.PersistentFlags().IntVar(&options.Current.FrameRate, "fps", options.Current.FrameRate, "capture frame rate, the driver default is used when 0")
+	rootCmd.PersistentFlags().StringVar(&options.Current.PixelFormat, "pixel-format", options.Current.PixelFormat, "capture pixel format: auto, mjpeg, yuyv or nv12, raw formats are encoded to JPEG in process")
+	rootCmd.PersistentFlags().IntVar(&options.Current.JPEGQuality, "jpeg-quality", options.Current.JPEGQuality, "quality of JPEG images encoded in process, from 1 to 100")
+	rootCmd.PersistentFlags().BoolVar(&options.Current.Loop, "loop", options.Current.Loop, "restart replayed captures once they ended")
+	rootCmd.PersistentFlags().IntVar(&options.Current.Rotation, "rotate", options.Current.Rotation, "clockwise rotation of the image: 0, 90, 180 or 270 degrees")
+	rootCmd.PersistentFlags().BoolVar(&options.Current.HorizontalFlip, "hflip", options.Current.HorizontalFlip, "mirror the image horizontally")
+	rootCmd.PersistentFlags().BoolVar(&options.Current.VerticalFlip, "vflip", options.Current.VerticalFlip, "flip the image vertically")
+	rootCmd.PersistentFlags().IntVar(&options.Current.SubWidth, "sub-width", options.Current.SubWidth, "width of the downscaled sub stream, the aspect ratio is kept when 0")
+	rootCmd.PersistentFlags().IntVar(&options.Current.SubHeight, "sub-height", options.Current.SubHeight, "height of the downscaled sub stream, the aspect ratio is kept when 0")
+	rootCmd.PersistentFlags().IntVar(&options.Current.SubQuality, "sub-quality", options.Current.SubQuality, "JPEG quality of the downscaled sub stream, from 1 to 100")
+	rootCmd.PersistentFlags().DurationVar(&options.Current.StallTimeout, "stall-timeout", options.Current.StallTimeout, "delay without frame after which a camera is recovered, defaults to 5s and is at least a few frame intervals")
+	rootCmd.PersistentFlags().StringVar(&options.Current.StallRecovery, "stall-recovery", options.Current.StallRecovery, "action taken on a stalled camera: reopen the device or exit with a non-zero code")
+	rootCmd.PersistentFlags().DurationVar(&options.Current.IdleTimeout, "idle-timeout", options.Current.IdleTimeout, "close the device once nobody watched for this long, it is opened again by the next viewer. 0 keeps it always open")
+	rootCmd.PersistentFlags().StringArrayVar(&options.Current.Cameras, "camera", options.Current.Cameras, "camera definition \"name=/dev/videoN,width=..,height=..,fps=..,format=..,quality=..,loop=..,rotate=..,hflip=..,vflip=..,subwidth=..,subheight=..,subquality=..,stalltimeout=..,stallrecovery=..,idletimeout=..\", can be repeated")
+	rootCmd.PersistentFlags().StringVar(&options.Current.DefaultCamera, "default-camera", options.Current.DefaultCamera, "name of the camera served on /stream, defaults to the first defined camera")
+	rootCmd.PersistentFlags().StringVar(&options.Current.StateDirectory, "state-dir", options.Current.StateDirectory, "directory persisting settings changed at runtime, like camera controls, nothing is persisted when empty")
 	rootCmd.PersistentFlags().BoolVar(&globals.Current.FallbackConfig, "fallback-config", globals.Current.FallbackConfig, "if no configuration was found, fallback to the default one")
 	//rootCmd.PersistentFlags().StringVarP(&globals.Current.ConfigPath, "config", "c", globals.Current.ConfigPath, "path to configuration file")
 	rootCmd.PersistentFlags().BoolVar(&globals.Current.Debug, "debug", globals.Current.Debug, "outputs processing information")
@@ -1,5 +1,11 @@
 package options
 
+import (
+	"time"
+
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
 var (
 	Current = NewOptions()
 )
@@ -9,6 +15,18 @@ func NewOptions() *Options {
 
 	options.Port = "8080"
 	options.Address = "0.0.0.0"
+	options.ShutdownTimeout = 10 * time.Second
+
+	options.Source = api.SourceV4L2
+	options.Device = api.DefaultDevice
+
+	options.PixelFormat = api.PixelFormatAuto
+	options.JPEGQuality = api.DefaultJPEGQuality
+
+	options.SubWidth = api.DefaultSubWidth
+	options.SubQuality = api.DefaultSubQuality
+
+	options.StallRecovery = api.StallRecoveryReopen
 
 	options.CaptureHeight = 520
 	options.CaptureWidth = 960
@@ -17,8 +35,28 @@ func NewOptions() *Options {
 }
 
 type Options struct {
-	Port          string
-	Address       string
-	CaptureHeight int
-	CaptureWidth  int
+	Port            string
+	RTSPPort        string
+	Address         string
+	ShutdownTimeout time.Duration
+	Source          string
+	Device          string
+	CaptureHeight   int
+	CaptureWidth    int
+	FrameRate       int
+	PixelFormat     string
+	JPEGQuality     int
+	Loop            bool
+	Rotation        int
+	HorizontalFlip  bool
+	VerticalFlip    bool
+	SubWidth        int
+	SubHeight       int
+	SubQuality      int
+	StallTimeout    time.Duration
+	StallRecovery   string
+	IdleTimeout     time.Duration
+	Cameras         []string
+	DefaultCamera   string
+	StateDirectory  string
 }
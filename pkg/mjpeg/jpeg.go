@@ -0,0 +1,162 @@
+package mjpeg
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// MaximumFrameSize bounds the memory used by a single image
+const MaximumFrameSize = 16 << 20
+
+const (
+	markerPrefix = 0xff
+	markerSOI    = 0xd8
+	markerEOI    = 0xd9
+	markerSOS    = 0xda
+	markerTEM    = 0x01
+	markerRST0   = 0xd0
+	markerRST7   = 0xd7
+)
+
+// ReadJPEG reads the next complete JPEG image, bytes preceding the start of image
+// marker are skipped. The segments are walked so that an end of image marker
+// inside metadata, like an EXIF thumbnail, does not cut the image short.
+// io.EOF is returned when no image starts before the end of the reader
+func ReadJPEG(r *bufio.Reader) ([]byte, error) {
+	err := skipToImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	image := []byte{markerPrefix, markerSOI}
+
+	for {
+		marker, err := readMarker(r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+
+		image = append(image, markerPrefix, marker)
+
+		switch {
+		case marker == markerEOI:
+			return image, nil
+		case marker == markerTEM, marker >= markerRST0 && marker <= markerRST7:
+			continue
+		}
+
+		image, err = appendSegment(r, image)
+		if err != nil {
+			return nil, err
+		}
+
+		if marker == markerSOS {
+			image, err = appendEntropyCodedData(r, image)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(image) > MaximumFrameSize {
+			return nil, errors.Errorf("image exceeds %d bytes", MaximumFrameSize)
+		}
+	}
+}
+
+func skipToImage(r *bufio.Reader) error {
+	previous := byte(0)
+
+	for {
+		current, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if previous == markerPrefix && current == markerSOI {
+			return nil
+		}
+
+		previous = current
+	}
+}
+
+// readMarker reads a marker, fill bytes are skipped
+func readMarker(r *bufio.Reader) (byte, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if prefix != markerPrefix {
+		return 0, errors.Errorf("expected marker, got %#x", prefix)
+	}
+
+	for {
+		marker, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if marker != markerPrefix {
+			return marker, nil
+		}
+	}
+}
+
+func appendSegment(r *bufio.Reader, image []byte) ([]byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	length := int(header[0])<<8 | int(header[1])
+	if length < 2 {
+		return nil, errors.Errorf("invalid segment length %d", length)
+	}
+
+	image = append(image, header...)
+
+	segment := make([]byte, length-2)
+	_, err = io.ReadFull(r, segment)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	return append(image, segment...), nil
+}
+
+// appendEntropyCodedData copies the scan data up to the next marker, which is left unread.
+// Inside the scan, 0xff is followed by a stuffed zero byte or a restart marker
+func appendEntropyCodedData(r *bufio.Reader, image []byte) ([]byte, error) {
+	for {
+		next, err := r.Peek(2)
+		if len(next) < 2 {
+			return nil, unexpected(err)
+		}
+
+		if next[0] != markerPrefix {
+			image = append(image, next[0])
+			r.Discard(1)
+			continue
+		}
+
+		if next[1] == 0x00 || (next[1] >= markerRST0 && next[1] <= markerRST7) {
+			image = append(image, next...)
+			r.Discard(2)
+			continue
+		}
+
+		return image, nil
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
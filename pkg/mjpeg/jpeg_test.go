@@ -0,0 +1,61 @@
+package mjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeImage(t *testing.T, width, height int) []byte {
+	buffer := new(bytes.Buffer)
+	err := jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	assert.NoError(t, err)
+
+	return buffer.Bytes()
+}
+
+// withMetadata inserts an APP1 segment containing an end of image marker,
+// as found in EXIF thumbnails
+func withMetadata(image []byte) []byte {
+	segment := []byte{0xff, 0xe1, 0x00, 0x06, 0xff, 0xd9, 0xff, 0xd8}
+
+	result := append([]byte{}, image[:2]...)
+	result = append(result, segment...)
+	return append(result, image[2:]...)
+}
+
+func Test_ReadJPEG(t *testing.T) {
+	first := encodeImage(t, 16, 8)
+	second := withMetadata(encodeImage(t, 32, 16))
+
+	stream := new(bytes.Buffer)
+	stream.WriteString("garbage")
+	stream.Write(first)
+	stream.WriteString("\r\n")
+	stream.Write(second)
+
+	reader := bufio.NewReader(stream)
+
+	image, err := ReadJPEG(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, first, image)
+
+	image, err = ReadJPEG(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, second, image)
+
+	_, err = ReadJPEG(reader)
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_ReadJPEG_Truncated(t *testing.T) {
+	image := encodeImage(t, 16, 8)
+
+	_, err := ReadJPEG(bufio.NewReader(bytes.NewReader(image[:len(image)-10])))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
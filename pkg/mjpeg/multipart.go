@@ -0,0 +1,102 @@
+package mjpeg
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// NewMultipartReader reads the images of a multipart/x-mixed-replace stream,
+// as served on /stream
+func NewMultipartReader(r io.Reader, boundary string) *multipartReader {
+	instance := new(multipartReader)
+
+	instance.reader = multipart.NewReader(r, boundary)
+
+	return instance
+}
+
+type multipartReader struct {
+	reader *multipart.Reader
+}
+
+// Next returns the next part as a frame, the capture timestamp and sequence
+// are taken from the part headers when present, io.EOF ends the stream
+func (i *multipartReader) Next() (*api.Frame, error) {
+	part, err := i.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	data, err := io.ReadAll(io.LimitReader(part, MaximumFrameSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read part")
+	}
+
+	if len(data) > MaximumFrameSize {
+		return nil, errors.Errorf("part exceeds %d bytes", MaximumFrameSize)
+	}
+
+	frame := &api.Frame{Data: data}
+
+	if value := part.Header.Get(HeaderTimestamp); value != "" {
+		if timestamp, err := ParseTimestamp(value); err == nil {
+			frame.Timestamp = timestamp
+		}
+	}
+
+	if value := part.Header.Get(HeaderSequence); value != "" {
+		if sequence, err := strconv.ParseUint(value, 10, 32); err == nil {
+			frame.Sequence = uint32(sequence)
+		}
+	}
+
+	return frame, nil
+}
+
+// DetectBoundary reads the boundary from the first delimiter line
+// of a recorded stream without consuming it
+func DetectBoundary(r *bufio.Reader) (string, error) {
+	for size := 64; ; size = size * 2 {
+		peeked, err := r.Peek(size)
+
+		if index := strings.IndexByte(string(peeked), '\n'); index >= 0 {
+			line := strings.TrimSpace(string(peeked[:index]))
+			if !strings.HasPrefix(line, "--") || len(line) == 2 {
+				return "", errors.Errorf("no multipart boundary found, first line is \"%s\"", line)
+			}
+
+			return strings.TrimPrefix(line, "--"), nil
+		}
+
+		if err != nil || size >= 4096 {
+			return "", errors.New("no multipart boundary found")
+		}
+	}
+}
+
+// BoundaryParameter extracts the boundary of a multipart content type
+func BoundaryParameter(contentType string) (string, error) {
+	mediaType, parameters, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid content type \"%s\"", contentType)
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return "", errors.Errorf("content type \"%s\" is not multipart", contentType)
+	}
+
+	boundary := parameters["boundary"]
+	if boundary == "" {
+		return "", errors.Errorf("content type \"%s\" has no boundary", contentType)
+	}
+
+	return boundary, nil
+}
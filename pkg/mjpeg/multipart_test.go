@@ -0,0 +1,90 @@
+package mjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MultipartReader(t *testing.T) {
+	timestamp := time.Unix(1700000000, 123456000)
+
+	stream := new(bytes.Buffer)
+	writer := multipart.NewWriter(stream)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", "image/jpeg")
+	header.Set(HeaderTimestamp, FormatTimestamp(timestamp))
+	header.Set(HeaderSequence, "42")
+	part, err := writer.CreatePart(header)
+	assert.NoError(t, err)
+	part.Write([]byte("first"))
+
+	header = make(textproto.MIMEHeader)
+	header.Set("Content-Type", "image/jpeg")
+	part, err = writer.CreatePart(header)
+	assert.NoError(t, err)
+	part.Write([]byte("second"))
+	writer.Close()
+
+	buffered := bufio.NewReader(stream)
+	boundary, err := DetectBoundary(buffered)
+	assert.NoError(t, err)
+	assert.Equal(t, writer.Boundary(), boundary)
+
+	reader := NewMultipartReader(buffered, boundary)
+
+	frame, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), frame.Data)
+	assert.True(t, timestamp.Equal(frame.Timestamp))
+	assert.Equal(t, uint32(42), frame.Sequence)
+
+	frame, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), frame.Data)
+	assert.True(t, frame.Timestamp.IsZero())
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func Test_DetectBoundary_NotMultipart(t *testing.T) {
+	_, err := DetectBoundary(bufio.NewReader(bytes.NewReader([]byte{0xff, 0xd8, 0xff, 0xe0, '\n'})))
+	assert.Error(t, err)
+}
+
+func Test_ParseTimestamp(t *testing.T) {
+	timestamp, err := ParseTimestamp("1700000000.5")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 500000000), timestamp)
+
+	timestamp, err = ParseTimestamp(FormatTimestamp(time.Unix(12, 34000)))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(12, 34000), timestamp)
+
+	_, err = ParseTimestamp("now")
+	assert.Error(t, err)
+}
+
+func Test_BoundaryParameter(t *testing.T) {
+	boundary, err := BoundaryParameter("multipart/x-mixed-replace; boundary=boundarydonotcross")
+	assert.NoError(t, err)
+	assert.Equal(t, "boundarydonotcross", boundary)
+
+	boundary, err = BoundaryParameter(`multipart/x-mixed-replace;boundary="--myboundary"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "--myboundary", boundary)
+
+	_, err = BoundaryParameter("image/jpeg")
+	assert.Error(t, err)
+
+	_, err = BoundaryParameter("multipart/x-mixed-replace")
+	assert.Error(t, err)
+}
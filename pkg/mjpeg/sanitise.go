@@ -0,0 +1,108 @@
+package mjpeg
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Sanitise checks that the frame holds a single complete JPEG image: it must start with
+// the start of image marker and its segments must lead to the end of image marker,
+// trailing bytes like driver padding are dropped. The standard Huffman tables are
+// inserted before the first scan when the image has none, like MJPEG frames of many webcams
+func Sanitise(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != markerPrefix || data[1] != markerSOI {
+		return nil, errors.New("missing start of image marker")
+	}
+
+	position := 2
+	huffman := false
+	scan := -1
+
+	for {
+		if position >= len(data) {
+			return nil, errors.New("missing end of image marker")
+		}
+
+		if data[position] != markerPrefix {
+			return nil, errors.Errorf("expected marker at offset %d, got %#x", position, data[position])
+		}
+
+		start := position
+		for position < len(data) && data[position] == markerPrefix {
+			position++
+		}
+
+		if position >= len(data) {
+			return nil, errors.New("missing end of image marker")
+		}
+
+		marker := data[position]
+		position++
+
+		switch {
+		case marker == markerEOI && scan < 0:
+			return nil, errors.New("missing image scan")
+		case marker == markerEOI:
+			return withHuffmanTables(data[:position], huffman, scan), nil
+		case marker == markerTEM, marker >= markerRST0 && marker <= markerRST7:
+			continue
+		}
+
+		if position+2 > len(data) {
+			return nil, errors.Errorf("truncated segment %#x", marker)
+		}
+
+		length := int(data[position])<<8 | int(data[position+1])
+		if length < 2 {
+			return nil, errors.Errorf("invalid segment length %d", length)
+		}
+
+		position = position + length
+		if position > len(data) {
+			return nil, errors.Errorf("truncated segment %#x", marker)
+		}
+
+		switch {
+		case marker == markerDHT && scan < 0:
+			huffman = true
+		case marker == markerSOS:
+			if scan < 0 {
+				scan = start
+			}
+
+			position = skipEntropyCodedData(data, position)
+		}
+	}
+}
+
+// skipEntropyCodedData returns the offset of the marker following the scan data,
+// or the length of the data when the scan is truncated
+func skipEntropyCodedData(data []byte, position int) int {
+	for position+1 < len(data) {
+		if data[position] != markerPrefix {
+			position++
+			continue
+		}
+
+		next := data[position+1]
+		if next == 0x00 || (next >= markerRST0 && next <= markerRST7) {
+			position = position + 2
+			continue
+		}
+
+		return position
+	}
+
+	return len(data)
+}
+
+func withHuffmanTables(image []byte, huffman bool, scan int) []byte {
+	if huffman {
+		return image
+	}
+
+	repaired := make([]byte, 0, len(image)+len(standardHuffmanSegment))
+	repaired = append(repaired, image[:scan]...)
+	repaired = append(repaired, standardHuffmanSegment...)
+
+	return append(repaired, image[scan:]...)
+}
@@ -0,0 +1,83 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeColorImage(t *testing.T) []byte {
+	src := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 16; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, src, nil))
+
+	return buffer.Bytes()
+}
+
+// withoutHuffmanTables removes the DHT segments, like MJPEG webcams do
+func withoutHuffmanTables(t *testing.T, data []byte) []byte {
+	start := bytes.Index(data, []byte{markerPrefix, markerDHT})
+	assert.Greater(t, start, 0)
+
+	length := int(data[start+2])<<8 | int(data[start+3])
+
+	result := append([]byte{}, data[:start]...)
+	return append(result, data[start+2+length:]...)
+}
+
+func Test_Sanitise(t *testing.T) {
+	valid := encodeColorImage(t)
+
+	cases := []struct {
+		name                 string
+		data                 []byte
+		expected             []byte
+		expectedErrorMessage string
+	}{
+		{name: "valid", data: valid, expected: valid},
+		{name: "trailing padding", data: append(append([]byte{}, valid...), 0, 0, 0), expected: valid},
+		{name: "missing huffman tables", data: withoutHuffmanTables(t, valid), expected: valid},
+		{name: "metadata", data: withMetadata(valid), expected: withMetadata(valid)},
+		{name: "empty", data: []byte{}, expectedErrorMessage: "missing start of image marker"},
+		{name: "leading garbage", data: append([]byte{0x00}, valid...), expectedErrorMessage: "missing start of image marker"},
+		{name: "truncated scan", data: valid[:len(valid)-20], expectedErrorMessage: "missing end of image marker"},
+		{name: "truncated header", data: valid[:40], expectedErrorMessage: "truncated segment 0xdb"},
+		{name: "no scan", data: []byte{0xff, 0xd8, 0xff, 0xd9}, expectedErrorMessage: "missing image scan"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			sanitised, err := Sanitise(c.data)
+			if c.expectedErrorMessage != "" {
+				assert.EqualError(tt, err, c.expectedErrorMessage)
+				return
+			}
+
+			assert.NoError(tt, err)
+			assert.Equal(tt, c.expected, sanitised)
+		})
+	}
+}
+
+func Test_SanitiseDecodes(t *testing.T) {
+	stripped := withoutHuffmanTables(t, encodeImage(t, 16, 16))
+
+	_, err := jpeg.Decode(bytes.NewReader(stripped))
+	assert.Error(t, err)
+
+	sanitised, err := Sanitise(stripped)
+	assert.NoError(t, err)
+
+	_, err = jpeg.Decode(bytes.NewReader(sanitised))
+	assert.NoError(t, err)
+}
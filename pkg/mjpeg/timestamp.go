@@ -0,0 +1,48 @@
+package mjpeg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HeaderTimestamp holds the capture time of a part
+	HeaderTimestamp = "X-Timestamp"
+	// HeaderSequence holds the capture sequence number of a part
+	HeaderSequence = "X-Sequence"
+)
+
+// FormatTimestamp renders a capture time as seconds with microsecond precision,
+// the format used by other MJPEG streamers
+func FormatTimestamp(timestamp time.Time) string {
+	return fmt.Sprintf("%d.%06d", timestamp.Unix(), timestamp.Nanosecond()/1000)
+}
+
+// ParseTimestamp reads a time written by FormatTimestamp,
+// any number of fractional digits is accepted
+func ParseTimestamp(value string) (time.Time, error) {
+	seconds, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid timestamp \"%s\"", value)
+	}
+
+	nanoseconds := int64(0)
+	if fraction != "" {
+		if len(fraction) > 9 {
+			fraction = fraction[:9]
+		}
+
+		nanoseconds, err = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Errorf("invalid timestamp \"%s\"", value)
+		}
+	}
+
+	return time.Unix(unix, nanoseconds), nil
+}
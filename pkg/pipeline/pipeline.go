@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+const (
+	// stageQueueSize is the number of frames waiting in front of each stage
+	stageQueueSize = 1
+	// averageWeight is the weight of the latest latency in the moving average
+	averageWeight = 0.1
+)
+
+// New runs every processor in its own goroutine, in the given order, so that
+// stages work on consecutive frames concurrently. Reading the source never blocks:
+// when the first stage is busy, the oldest waiting frame is skipped.
+// The output is closed once the source is exhausted or the context ends
+func New(ctx context.Context, source <-chan *api.Frame, processors ...api.FrameProcessor) *pipeline {
+	instance := new(pipeline)
+
+	input := make(chan *api.Frame, stageQueueSize)
+	go instance.feed(ctx, source, input)
+
+	frames := (<-chan *api.Frame)(input)
+	for _, processor := range processors {
+		stage := &stage{processor: processor}
+		instance.stages = append(instance.stages, stage)
+
+		output := make(chan *api.Frame, stageQueueSize)
+		go stage.run(ctx, frames, output)
+		frames = output
+	}
+
+	instance.output = frames
+
+	return instance
+}
+
+var _ api.Pipeline = &pipeline{}
+
+type pipeline struct {
+	mutex   sync.Mutex
+	skipped uint64
+	stages  []*stage
+	output  <-chan *api.Frame
+}
+
+func (i *pipeline) Output() <-chan *api.Frame {
+	return i.output
+}
+
+func (i *pipeline) Statistics() *api.PipelineStatistics {
+	i.mutex.Lock()
+	statistics := &api.PipelineStatistics{
+		Skipped: i.skipped,
+		Stages:  make([]*api.StageStatistics, 0, len(i.stages)),
+	}
+	i.mutex.Unlock()
+
+	for _, stage := range i.stages {
+		statistics.Stages = append(statistics.Stages, stage.statistics())
+	}
+
+	return statistics
+}
+
+func (i *pipeline) feed(ctx context.Context, source <-chan *api.Frame, input chan *api.Frame) {
+	defer close(input)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-source:
+			if !ok {
+				return
+			}
+
+			select {
+			case input <- frame:
+			default:
+				select {
+				case <-input:
+					i.skip()
+				default:
+				}
+				input <- frame
+			}
+		}
+	}
+}
+
+func (i *pipeline) skip() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.skipped = i.skipped + 1
+}
+
+type stage struct {
+	processor api.FrameProcessor
+	mutex     sync.Mutex
+	processed uint64
+	dropped   uint64
+	errors    uint64
+	last      time.Duration
+	average   float64
+	maximum   time.Duration
+}
+
+func (i *stage) run(ctx context.Context, input <-chan *api.Frame, output chan<- *api.Frame) {
+	defer close(output)
+
+	for frame := range input {
+		start := time.Now()
+		processed, err := i.processor.Process(frame)
+		i.record(time.Since(start), processed == nil, err)
+
+		if err != nil {
+			log.Debug().Msgf("stage \"%s\" dropped frame %d: %s", i.processor.Name(), frame.Sequence, err)
+			continue
+		}
+
+		if processed == nil {
+			continue
+		}
+
+		select {
+		case output <- processed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (i *stage) record(latency time.Duration, dropped bool, err error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.processed = i.processed + 1
+	i.last = latency
+	i.maximum = max(i.maximum, latency)
+
+	if i.processed == 1 {
+		i.average = float64(latency)
+	} else {
+		i.average = i.average + averageWeight*(float64(latency)-i.average)
+	}
+
+	switch {
+	case err != nil:
+		i.errors = i.errors + 1
+	case dropped:
+		i.dropped = i.dropped + 1
+	}
+}
+
+func (i *stage) statistics() *api.StageStatistics {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return &api.StageStatistics{
+		Name:           i.processor.Name(),
+		Processed:      i.processed,
+		Dropped:        i.dropped,
+		Errors:         i.errors,
+		LastLatency:    milliseconds(float64(i.last)),
+		AverageLatency: milliseconds(i.average),
+		MaximumLatency: milliseconds(float64(i.maximum)),
+	}
+}
+
+func milliseconds(nanoseconds float64) float64 {
+	return nanoseconds / float64(time.Millisecond)
+}
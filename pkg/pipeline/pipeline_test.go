@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// processorFunc adapts a function to a named frame processor
+type processorFunc struct {
+	name    string
+	process func(frame *api.Frame) (*api.Frame, error)
+}
+
+func (i *processorFunc) Name() string {
+	return i.name
+}
+
+func (i *processorFunc) Process(frame *api.Frame) (*api.Frame, error) {
+	return i.process(frame)
+}
+
+func appendByte(name string, value byte) *processorFunc {
+	return &processorFunc{name: name, process: func(frame *api.Frame) (*api.Frame, error) {
+		processed := *frame
+		processed.Data = append(append([]byte{}, frame.Data...), value)
+		return &processed, nil
+	}}
+}
+
+func Test_Pipeline_Order(t *testing.T) {
+	source := make(chan *api.Frame)
+	p := New(context.Background(), source, appendByte("first", 'a'), appendByte("second", 'b'))
+
+	go func() {
+		source <- &api.Frame{Data: []byte("x")}
+		close(source)
+	}()
+
+	frame, ok := <-p.Output()
+	assert.True(t, ok)
+	assert.Equal(t, "xab", string(frame.Data))
+
+	_, ok = <-p.Output()
+	assert.False(t, ok, "output closes with the source")
+
+	statistics := p.Statistics()
+	assert.Len(t, statistics.Stages, 2)
+	assert.Equal(t, "first", statistics.Stages[0].Name)
+	assert.Equal(t, uint64(1), statistics.Stages[1].Processed)
+}
+
+func Test_Pipeline_DropAndErrors(t *testing.T) {
+	filter := &processorFunc{name: "filter", process: func(frame *api.Frame) (*api.Frame, error) {
+		switch frame.Sequence % 3 {
+		case 0:
+			return nil, nil
+		case 1:
+			return nil, errors.New("broken")
+		default:
+			return frame, nil
+		}
+	}}
+
+	source := make(chan *api.Frame)
+	p := New(context.Background(), source, filter)
+
+	go func() {
+		for sequence := uint32(0); sequence < 6; sequence++ {
+			source <- &api.Frame{Sequence: sequence}
+			// leave the stage time to take every frame
+			time.Sleep(5 * time.Millisecond)
+		}
+		close(source)
+	}()
+
+	sequences := make([]uint32, 0)
+	for frame := range p.Output() {
+		sequences = append(sequences, frame.Sequence)
+	}
+
+	assert.Equal(t, []uint32{2, 5}, sequences)
+
+	statistics := p.Statistics().Stages[0]
+	assert.Equal(t, uint64(6), statistics.Processed)
+	assert.Equal(t, uint64(2), statistics.Dropped)
+	assert.Equal(t, uint64(2), statistics.Errors)
+}
+
+// Test_Pipeline_Concurrent checks that stages overlap: two stages of 20ms
+// process 10 frames in much less than the 400ms a sequential run takes
+func Test_Pipeline_Concurrent(t *testing.T) {
+	slow := func(name string) *processorFunc {
+		return &processorFunc{name: name, process: func(frame *api.Frame) (*api.Frame, error) {
+			time.Sleep(20 * time.Millisecond)
+			return frame, nil
+		}}
+	}
+
+	source := make(chan *api.Frame)
+	p := New(context.Background(), source, slow("first"), slow("second"))
+
+	start := time.Now()
+	go func() {
+		for sequence := uint32(0); sequence < 10; sequence++ {
+			source <- &api.Frame{Sequence: sequence}
+			time.Sleep(20 * time.Millisecond)
+		}
+		close(source)
+	}()
+
+	count := 0
+	for range p.Output() {
+		count = count + 1
+	}
+
+	assert.Less(t, time.Since(start), 350*time.Millisecond)
+	assert.Greater(t, count, 5)
+	assert.GreaterOrEqual(t, p.Statistics().Stages[0].AverageLatency, 20.0)
+}
+
+func Test_Pipeline_Passthrough(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	source := make(chan *api.Frame)
+	p := New(ctx, source)
+
+	go func() {
+		source <- &api.Frame{Sequence: 7}
+	}()
+
+	frame := <-p.Output()
+	assert.Equal(t, uint32(7), frame.Sequence)
+
+	cancel()
+	_, ok := <-p.Output()
+	assert.False(t, ok, "output closes with the context")
+}
@@ -0,0 +1,216 @@
+package rtsp
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	markerPrefix = 0xff
+	markerSOI    = 0xd8
+	markerSOF0   = 0xc0
+	markerSOF1   = 0xc1
+	markerDHT    = 0xc4
+	markerSOS    = 0xda
+	markerDQT    = 0xdb
+	markerDRI    = 0xdd
+	markerRST0   = 0xd0
+	markerRST7   = 0xd7
+)
+
+const (
+	// RFC 2435 types: 4:2:2 and 4:2:0 subsampling, restart markers add 64
+	jpegType422     = 0
+	jpegType420     = 1
+	jpegTypeRestart = 64
+	// jpegDynamicQuality announces quantization tables in the first packet of a frame
+	jpegDynamicQuality = 255
+	// jpegMaximumDimension is the largest size expressed in 8 pixel blocks on a single byte
+	jpegMaximumDimension = 2040
+	jpegHeaderLength     = 8
+	restartHeaderLength  = 4
+	quantizationLength   = 64
+)
+
+// jpegImage holds the parts of a baseline JPEG transmitted by RFC 2435,
+// the receiver rebuilds the headers with the standard Huffman tables
+type jpegImage struct {
+	kind            byte
+	width           int
+	height          int
+	restartInterval uint16
+	quantization    []byte
+	scan            []byte
+}
+
+// parseJPEG extracts the RFC 2435 fields of a baseline, 8 bit, YCbCr JPEG image
+// with 4:2:2 or 4:2:0 subsampling
+func parseJPEG(data []byte) (*jpegImage, error) {
+	if len(data) < 4 || data[0] != markerPrefix || data[1] != markerSOI {
+		return nil, errors.New("missing start of image marker")
+	}
+
+	image := new(jpegImage)
+	tables := make([][]byte, 4)
+	kindFound := false
+	position := 2
+
+	for {
+		if position+4 > len(data) || data[position] != markerPrefix {
+			return nil, errors.Errorf("expected marker at offset %d", position)
+		}
+
+		marker := data[position+1]
+		length := int(binary.BigEndian.Uint16(data[position+2:]))
+		segment := position + 4
+		end := position + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.Errorf("truncated segment %#x", marker)
+		}
+
+		switch marker {
+		case markerDQT:
+			err := readQuantizationTables(data[segment:end], tables)
+			if err != nil {
+				return nil, err
+			}
+		case markerSOF0, markerSOF1:
+			err := image.readFrameHeader(data[segment:end])
+			if err != nil {
+				return nil, err
+			}
+			kindFound = true
+		case markerDRI:
+			if end-segment < 2 {
+				return nil, errors.New("truncated restart interval")
+			}
+			image.restartInterval = binary.BigEndian.Uint16(data[segment:])
+		case markerSOS:
+			if !kindFound {
+				return nil, errors.New("missing baseline frame header")
+			}
+
+			image.scan = data[end:scanEnd(data, end)]
+			for _, table := range tables {
+				image.quantization = append(image.quantization, table...)
+			}
+
+			if image.restartInterval > 0 {
+				image.kind = image.kind + jpegTypeRestart
+			}
+
+			return image, nil
+		default:
+			if marker >= 0xc2 && marker <= 0xcf && marker != markerDHT {
+				return nil, errors.Errorf("unsupported JPEG process %#x", marker)
+			}
+		}
+
+		position = end
+	}
+}
+
+// readQuantizationTables stores the 8 bit tables of a DQT segment by identifier
+func readQuantizationTables(segment []byte, tables [][]byte) error {
+	for len(segment) > 0 {
+		precision := segment[0] >> 4
+		id := segment[0] & 0x0f
+
+		if precision != 0 {
+			return errors.New("unsupported 16 bit quantization table")
+		}
+
+		if id > 3 || len(segment) < 1+quantizationLength {
+			return errors.New("invalid quantization table")
+		}
+
+		tables[id] = segment[1 : 1+quantizationLength]
+		segment = segment[1+quantizationLength:]
+	}
+
+	return nil
+}
+
+func (i *jpegImage) readFrameHeader(segment []byte) error {
+	if len(segment) < 6 || segment[0] != 8 {
+		return errors.New("unsupported sample precision")
+	}
+
+	i.height = int(binary.BigEndian.Uint16(segment[1:]))
+	i.width = int(binary.BigEndian.Uint16(segment[3:]))
+
+	if i.width > jpegMaximumDimension || i.height > jpegMaximumDimension {
+		return errors.Errorf("image size %dx%d exceeds %d pixels", i.width, i.height, jpegMaximumDimension)
+	}
+
+	components := int(segment[5])
+	if components != 3 || len(segment) < 6+3*components {
+		return errors.Errorf("unsupported number of components %d", components)
+	}
+
+	switch segment[7] {
+	case 0x21:
+		i.kind = jpegType422
+	case 0x22:
+		i.kind = jpegType420
+	default:
+		return errors.Errorf("unsupported luma sampling %#x", segment[7])
+	}
+
+	if segment[10] != 0x11 || segment[13] != 0x11 {
+		return errors.New("unsupported chroma sampling")
+	}
+
+	return nil
+}
+
+// scanEnd returns the offset of the marker following the entropy coded data
+func scanEnd(data []byte, position int) int {
+	for position+1 < len(data) {
+		next := data[position+1]
+		if data[position] == markerPrefix && next != 0x00 && (next < markerRST0 || next > markerRST7) {
+			return position
+		}
+		position++
+	}
+
+	return len(data)
+}
+
+// packetize splits the image into RFC 2435 payloads of at most size bytes,
+// the quantization tables are sent in the first one
+func (i *jpegImage) packetize(size int) [][]byte {
+	payloads := make([][]byte, 0)
+	offset := 0
+
+	for offset < len(i.scan) || len(payloads) == 0 {
+		payload := make([]byte, jpegHeaderLength, size)
+
+		payload[1] = byte(offset >> 16)
+		payload[2] = byte(offset >> 8)
+		payload[3] = byte(offset)
+		payload[4] = i.kind
+		payload[5] = jpegDynamicQuality
+		payload[6] = byte((i.width + 7) / 8)
+		payload[7] = byte((i.height + 7) / 8)
+
+		if i.restartInterval > 0 {
+			// restart count 0x3fff with both flags: the payloads are not aligned on restart intervals
+			payload = append(payload, byte(i.restartInterval>>8), byte(i.restartInterval), 0xff, 0xff)
+		}
+
+		if offset == 0 {
+			payload = append(payload, 0, 0, byte(len(i.quantization)>>8), byte(len(i.quantization)))
+			payload = append(payload, i.quantization...)
+		}
+
+		chunk := min(size-len(payload), len(i.scan)-offset)
+		payload = append(payload, i.scan[offset:offset+chunk]...)
+		offset = offset + chunk
+
+		payloads = append(payloads, payload)
+	}
+
+	return payloads
+}
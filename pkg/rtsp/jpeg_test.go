@@ -0,0 +1,104 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeColorImage(t *testing.T, width, height int) []byte {
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, src, nil))
+
+	return buffer.Bytes()
+}
+
+func Test_ParseJPEG(t *testing.T) {
+	data := encodeColorImage(t, 100, 60)
+
+	image, err := parseJPEG(data)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(jpegType420), image.kind)
+	assert.Equal(t, 100, image.width)
+	assert.Equal(t, 60, image.height)
+	assert.Len(t, image.quantization, 2*quantizationLength)
+	assert.True(t, bytes.HasSuffix(data, append(image.scan, markerPrefix, 0xd9)), "scan ends before the end of image marker")
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "no start of image", data: data[2:]},
+		{name: "truncated", data: data[:100]},
+		{name: "grayscale", data: encodeGrayImage(t)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			_, err := parseJPEG(c.data)
+			assert.Error(tt, err)
+		})
+	}
+}
+
+func encodeGrayImage(t *testing.T) []byte {
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buffer, image.NewGray(image.Rect(0, 0, 16, 16)), nil))
+
+	return buffer.Bytes()
+}
+
+func Test_Packetize(t *testing.T) {
+	image, err := parseJPEG(encodeColorImage(t, 320, 240))
+	assert.NoError(t, err)
+
+	payloads := image.packetize(300)
+	assert.Greater(t, len(payloads), 1)
+
+	scan := make([]byte, 0)
+	for n, payload := range payloads {
+		assert.LessOrEqual(t, len(payload), 300)
+
+		offset := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+		assert.Equal(t, len(scan), offset, "fragment offset of payload %d", n)
+		assert.Equal(t, byte(jpegType420), payload[4])
+		assert.Equal(t, byte(jpegDynamicQuality), payload[5])
+		assert.Equal(t, byte(40), payload[6])
+		assert.Equal(t, byte(30), payload[7])
+
+		data := payload[jpegHeaderLength:]
+		if n == 0 {
+			length := int(binary.BigEndian.Uint16(data[2:]))
+			assert.Equal(t, image.quantization, data[4:4+length])
+			data = data[4+length:]
+		}
+
+		scan = append(scan, data...)
+	}
+
+	assert.Equal(t, image.scan, scan)
+}
+
+func Test_PacketizeRestartInterval(t *testing.T) {
+	image, err := parseJPEG(encodeColorImage(t, 32, 16))
+	assert.NoError(t, err)
+	image.restartInterval = 4
+	image.kind = image.kind + jpegTypeRestart
+
+	payload := image.packetize(rtpMaximumPayload)[0]
+	assert.Equal(t, byte(jpegType420+jpegTypeRestart), payload[4])
+	assert.Equal(t, []byte{0, 4, 0xff, 0xff}, payload[jpegHeaderLength:jpegHeaderLength+restartHeaderLength])
+}
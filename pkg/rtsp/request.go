@@ -0,0 +1,127 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rtspVersion = "RTSP/1.0"
+	// maximumBodySize bounds the request bodies, which are discarded
+	maximumBodySize = 64 << 10
+)
+
+// RTSP status codes missing from net/http
+const (
+	statusSessionNotFound      = 454
+	statusAggregateNotAllowed  = 459
+	statusUnsupportedTransport = 461
+)
+
+var statusText = map[int]string{
+	statusSessionNotFound:      "Session Not Found",
+	statusAggregateNotAllowed:  "Aggregate Operation Not Allowed",
+	statusUnsupportedTransport: "Unsupported Transport",
+}
+
+type request struct {
+	method string
+	url    *url.URL
+	header textproto.MIMEHeader
+}
+
+// readRequest reads the next request, its body is discarded
+func readRequest(reader *bufio.Reader) (*request, error) {
+	text := textproto.NewReader(reader)
+
+	line, err := text.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[2] != rtspVersion {
+		return nil, errors.Errorf("malformed request line \"%s\"", line)
+	}
+
+	location, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, errors.Wrapf(err, "malformed request url \"%s\"", parts[1])
+	}
+
+	header, err := text.ReadMIMEHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed request header")
+	}
+
+	if value := header.Get("Content-Length"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 || length > maximumBodySize {
+			return nil, errors.Errorf("invalid content length \"%s\"", value)
+		}
+
+		_, err = io.CopyN(io.Discard, reader, int64(length))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read request body")
+		}
+	}
+
+	return &request{method: parts[0], url: location, header: header}, nil
+}
+
+// session returns the session identifier without its parameters
+func (i *request) session() string {
+	id, _, _ := strings.Cut(i.header.Get("Session"), ";")
+	return strings.TrimSpace(id)
+}
+
+type response struct {
+	status int
+	// header lines are written in order
+	header [][2]string
+	body   string
+	// written runs once the response was sent, e.g. to start streaming after the PLAY answer
+	written func()
+}
+
+func newResponse(status int) *response {
+	return &response{status: status}
+}
+
+func (i *response) set(key, value string) *response {
+	i.header = append(i.header, [2]string{key, value})
+	return i
+}
+
+func (i *response) write(w io.Writer, sequence string) error {
+	text, ok := statusText[i.status]
+	if !ok {
+		text = http.StatusText(i.status)
+	}
+
+	builder := new(strings.Builder)
+	fmt.Fprintf(builder, "%s %d %s\r\n", rtspVersion, i.status, text)
+	fmt.Fprintf(builder, "CSeq: %s\r\n", sequence)
+
+	for _, header := range i.header {
+		fmt.Fprintf(builder, "%s: %s\r\n", header[0], header[1])
+	}
+
+	if i.body != "" {
+		fmt.Fprintf(builder, "Content-Length: %d\r\n", len(i.body))
+	}
+
+	builder.WriteString("\r\n")
+	builder.WriteString(i.body)
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
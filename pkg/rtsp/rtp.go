@@ -0,0 +1,68 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	rtpVersion     = 2
+	rtpHeaderSize  = 12
+	rtpPayloadJPEG = 26
+	rtpClockRate   = 90000
+	// rtpMaximumPayload keeps packets below the usual MTU
+	rtpMaximumPayload = 1400
+)
+
+func newPacketizer() *packetizer {
+	instance := new(packetizer)
+	instance.ssrc = rand.Uint32()
+	instance.sequence = uint16(rand.Uint32())
+	instance.timestamp = rand.Uint32()
+
+	return instance
+}
+
+// packetizer turns frames into RTP packets of a single stream
+type packetizer struct {
+	ssrc      uint32
+	sequence  uint16
+	timestamp uint32
+	// first is the capture time of the first frame, later timestamps are relative to it
+	first time.Time
+}
+
+// rtpTime converts the capture time to the 90kHz clock of the stream
+func (i *packetizer) rtpTime(captured time.Time) uint32 {
+	if i.first.IsZero() {
+		i.first = captured
+	}
+
+	return i.timestamp + uint32(int64(captured.Sub(i.first).Seconds()*rtpClockRate))
+}
+
+// packets prefixes the payloads of a frame with RTP headers,
+// the marker bit flags the last packet of the frame
+func (i *packetizer) packets(payloads [][]byte, captured time.Time) [][]byte {
+	timestamp := i.rtpTime(captured)
+	packets := make([][]byte, 0, len(payloads))
+
+	for n, payload := range payloads {
+		packet := make([]byte, rtpHeaderSize, rtpHeaderSize+len(payload))
+
+		packet[0] = rtpVersion << 6
+		packet[1] = rtpPayloadJPEG
+		if n == len(payloads)-1 {
+			packet[1] = packet[1] | 0x80
+		}
+		binary.BigEndian.PutUint16(packet[2:], i.sequence)
+		binary.BigEndian.PutUint32(packet[4:], timestamp)
+		binary.BigEndian.PutUint32(packet[8:], i.ssrc)
+
+		packets = append(packets, append(packet, payload...))
+		i.sequence++
+	}
+
+	return packets
+}
@@ -0,0 +1,385 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+const (
+	// trackControl is the control path of the single video track
+	trackControl = "track1"
+	// sessionTimeout is announced to clients, sessions end with their connection
+	sessionTimeout = 60
+	// writeTimeout drops interleaved clients which stopped reading
+	writeTimeout  = 10 * time.Second
+	publicMethods = "OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER"
+)
+
+// New serves every camera of the registry on rtsp://<address>/<camera name>,
+// the default camera is also served on the root path
+func New(cameras api.Registry, address string) *server {
+	instance := new(server)
+	instance.cameras = cameras
+	instance.address = address
+	instance.connections = make(map[*connection]struct{})
+
+	return instance
+}
+
+type server struct {
+	cameras     api.Registry
+	address     string
+	listener    net.Listener
+	mutex       sync.Mutex
+	connections map[*connection]struct{}
+	closed      bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	handlers    sync.WaitGroup
+}
+
+// Start listens for clients, connections are served in the background
+func (i *server) Start() error {
+	listener, err := net.Listen("tcp", i.address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to initiate RTSP listener on %s", i.address)
+	}
+
+	i.listener = listener
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+
+	go i.serve()
+
+	return nil
+}
+
+// Close stops listening and ends every session
+func (i *server) Close() error {
+	i.mutex.Lock()
+	i.closed = true
+	for connection := range i.connections {
+		connection.conn.Close()
+	}
+	i.mutex.Unlock()
+
+	if i.listener == nil {
+		return nil
+	}
+
+	err := i.listener.Close()
+	i.cancel()
+	i.handlers.Wait()
+
+	return err
+}
+
+func (i *server) serve() {
+	for {
+		conn, err := i.listener.Accept()
+		if err != nil {
+			if i.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Error().Msgf("rtsp: failed to accept connection: %s", err)
+			}
+			return
+		}
+
+		i.mutex.Lock()
+		if i.closed {
+			i.mutex.Unlock()
+			conn.Close()
+			return
+		}
+
+		connection := newConnection(i, conn)
+		i.connections[connection] = struct{}{}
+		i.handlers.Add(1)
+		i.mutex.Unlock()
+
+		go func() {
+			defer i.handlers.Done()
+			connection.handle(i.ctx)
+
+			i.mutex.Lock()
+			delete(i.connections, connection)
+			i.mutex.Unlock()
+		}()
+	}
+}
+
+// camera resolves the camera named by the first path segment,
+// the track control segment is ignored and the root path serves the default camera
+func (i *server) camera(location *url.URL) (api.Camera, error) {
+	path := strings.Trim(location.Path, "/")
+	if path == trackControl || strings.HasSuffix(path, "/"+trackControl) {
+		path = strings.TrimSuffix(strings.TrimSuffix(path, trackControl), "/")
+	}
+
+	if path == "" {
+		return i.cameras.Default()
+	}
+
+	name, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid camera path \"%s\"", path)
+	}
+
+	return i.cameras.Get(name)
+}
+
+func newConnection(server *server, conn net.Conn) *connection {
+	instance := new(connection)
+	instance.server = server
+	instance.conn = conn
+	instance.reader = bufio.NewReader(conn)
+	instance.sessions = make(map[string]*session)
+
+	return instance
+}
+
+// connection serves the requests of a single client,
+// the sessions set up on it end when it closes
+type connection struct {
+	server   *server
+	conn     net.Conn
+	reader   *bufio.Reader
+	mutex    sync.Mutex
+	sessions map[string]*session
+}
+
+func (i *connection) handle(ctx context.Context) {
+	remote := i.conn.RemoteAddr().String()
+	log.Debug().Msgf("rtsp client %s connected", remote)
+
+	defer func() {
+		for _, session := range i.sessions {
+			session.stop()
+		}
+		i.conn.Close()
+		log.Debug().Msgf("rtsp client %s disconnected", remote)
+	}()
+
+	for {
+		err := i.skipInterleaved()
+		if err != nil {
+			return
+		}
+
+		req, err := readRequest(i.reader)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Msgf("rtsp client %s: %s", remote, err)
+			}
+			return
+		}
+
+		log.Debug().Msgf("rtsp client %s: %s %s", remote, req.method, req.url)
+		res := i.dispatch(ctx, req)
+
+		i.mutex.Lock()
+		err = res.write(i.conn, req.header.Get("CSeq"))
+		i.mutex.Unlock()
+		if err != nil {
+			return
+		}
+
+		if res.written != nil {
+			res.written()
+		}
+	}
+}
+
+// skipInterleaved discards the RTCP reports of interleaved clients
+func (i *connection) skipInterleaved() error {
+	for {
+		next, err := i.reader.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		if next[0] != '$' {
+			return nil
+		}
+
+		header := make([]byte, 4)
+		_, err = io.ReadFull(i.reader, header)
+		if err != nil {
+			return err
+		}
+
+		_, err = i.reader.Discard(int(binary.BigEndian.Uint16(header[2:])))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (i *connection) writeInterleaved(channel byte, packet []byte) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	err := i.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err != nil {
+		return err
+	}
+
+	header := []byte{'$', channel, byte(len(packet) >> 8), byte(len(packet))}
+	_, err = i.conn.Write(append(header, packet...))
+
+	return err
+}
+
+func (i *connection) dispatch(ctx context.Context, req *request) *response {
+	switch req.method {
+	case "OPTIONS":
+		return newResponse(http.StatusOK).set("Public", publicMethods)
+	case "DESCRIBE":
+		return i.describe(req)
+	case "SETUP":
+		return i.setup(req)
+	case "PLAY":
+		return i.play(ctx, req)
+	case "TEARDOWN":
+		return i.teardown(req)
+	case "GET_PARAMETER":
+		// keep alive
+		return newResponse(http.StatusOK)
+	default:
+		return newResponse(http.StatusNotImplemented).set("Public", publicMethods)
+	}
+}
+
+func (i *connection) describe(req *request) *response {
+	cam, err := i.server.camera(req.url)
+	if err != nil {
+		return newResponse(http.StatusNotFound)
+	}
+
+	host, _, _ := net.SplitHostPort(i.conn.LocalAddr().String())
+
+	description := new(strings.Builder)
+	fmt.Fprintf(description, "v=0\r\n")
+	fmt.Fprintf(description, "o=- %d 1 IN IP4 %s\r\n", time.Now().Unix(), host)
+	fmt.Fprintf(description, "s=%s\r\n", cam.Name())
+	fmt.Fprintf(description, "c=IN IP4 0.0.0.0\r\n")
+	fmt.Fprintf(description, "t=0 0\r\n")
+	fmt.Fprintf(description, "a=control:*\r\n")
+	fmt.Fprintf(description, "m=video 0 RTP/AVP %d\r\n", rtpPayloadJPEG)
+	fmt.Fprintf(description, "a=rtpmap:%d JPEG/%d\r\n", rtpPayloadJPEG, rtpClockRate)
+	if frameRate := cam.Options().FrameRate; frameRate > 0 {
+		fmt.Fprintf(description, "a=framerate:%d\r\n", frameRate)
+	}
+	fmt.Fprintf(description, "a=control:%s\r\n", trackControl)
+
+	base := *req.url
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+
+	res := newResponse(http.StatusOK).
+		set("Content-Base", base.String()).
+		set("Content-Type", "application/sdp")
+	res.body = description.String()
+
+	return res
+}
+
+func (i *connection) setup(req *request) *response {
+	if req.session() != "" {
+		// a single track is served, there is nothing to add to a session
+		return newResponse(statusAggregateNotAllowed)
+	}
+
+	cam, err := i.server.camera(req.url)
+	if err != nil {
+		return newResponse(http.StatusNotFound)
+	}
+
+	negotiated, err := parseTransport(req.header.Get("Transport"))
+	if err != nil {
+		log.Debug().Msgf("rtsp client %s: %s", i.conn.RemoteAddr(), err)
+		return newResponse(statusUnsupportedTransport)
+	}
+
+	var delivery sender
+	if negotiated.tcp {
+		delivery = &interleavedSender{connection: i, channels: negotiated.interleaved}
+	} else {
+		remote := i.conn.RemoteAddr().(*net.TCPAddr).IP
+		delivery, err = newUDPSender(remote, negotiated.clientPorts)
+		if err != nil {
+			log.Warn().Msgf("rtsp client %s: %s", i.conn.RemoteAddr(), err)
+			return newResponse(http.StatusInternalServerError)
+		}
+	}
+
+	created := &session{
+		id:         sessionID(),
+		camera:     cam,
+		control:    req.url.String(),
+		sender:     delivery,
+		packetizer: newPacketizer(),
+	}
+	i.sessions[created.id] = created
+
+	return newResponse(http.StatusOK).
+		set("Transport", delivery.description(created.packetizer.ssrc)).
+		set("Session", fmt.Sprintf("%s;timeout=%d", created.id, sessionTimeout))
+}
+
+func (i *connection) play(ctx context.Context, req *request) *response {
+	session, ok := i.sessions[req.session()]
+	if !ok {
+		return newResponse(statusSessionNotFound)
+	}
+
+	res := newResponse(http.StatusOK).
+		set("Session", session.id).
+		set("Range", "npt=0.000-")
+
+	if session.playing() {
+		return res
+	}
+
+	res.set("RTP-Info", fmt.Sprintf("url=%s;seq=%d;rtptime=%d", session.control, session.packetizer.sequence, session.packetizer.timestamp))
+
+	// interleaved packets must not reach the client before the answer
+	res.written = func() {
+		session.play(ctx)
+		log.Info().Msgf("rtsp client %s playing camera \"%s\"", i.conn.RemoteAddr(), session.camera.Name())
+	}
+
+	return res
+}
+
+func (i *connection) teardown(req *request) *response {
+	session, ok := i.sessions[req.session()]
+	if !ok {
+		return newResponse(statusSessionNotFound)
+	}
+
+	session.stop()
+	delete(i.sessions, session.id)
+	log.Info().Msgf("rtsp client %s stopped camera \"%s\"", i.conn.RemoteAddr(), session.camera.Name())
+
+	return newResponse(http.StatusOK).set("Session", session.id)
+}
+
+func sessionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return strings.ToUpper(hex.EncodeToString(id))
+}
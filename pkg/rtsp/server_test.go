@@ -0,0 +1,237 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+)
+
+// client is a minimal RTSP client reading responses and interleaved packets
+type client struct {
+	t        *testing.T
+	conn     net.Conn
+	reader   *bufio.Reader
+	sequence int
+	// skipped counts the packets received before a response
+	skipped int
+}
+
+type clientResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   string
+}
+
+func (i *client) request(method, location string, headers ...string) *clientResponse {
+	i.sequence++
+
+	message := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, location, i.sequence)
+	for _, header := range headers {
+		message = message + header + "\r\n"
+	}
+
+	_, err := io.WriteString(i.conn, message+"\r\n")
+	assert.NoError(i.t, err)
+
+	for {
+		// skip the packets sent before the response
+		next, err := i.reader.Peek(1)
+		assert.NoError(i.t, err)
+		if next[0] != '$' {
+			break
+		}
+		i.packet()
+		i.skipped++
+	}
+
+	text := textproto.NewReader(i.reader)
+	line, err := text.ReadLine()
+	assert.NoError(i.t, err)
+
+	parts := strings.SplitN(line, " ", 3)
+	assert.Equal(i.t, "RTSP/1.0", parts[0])
+	status, err := strconv.Atoi(parts[1])
+	assert.NoError(i.t, err)
+
+	header, err := text.ReadMIMEHeader()
+	assert.NoError(i.t, err)
+	assert.Equal(i.t, strconv.Itoa(i.sequence), header.Get("CSeq"))
+
+	body := make([]byte, 0)
+	if value := header.Get("Content-Length"); value != "" {
+		length, err := strconv.Atoi(value)
+		assert.NoError(i.t, err)
+		body = make([]byte, length)
+		_, err = io.ReadFull(i.reader, body)
+		assert.NoError(i.t, err)
+	}
+
+	return &clientResponse{status: status, header: header, body: string(body)}
+}
+
+func (i *client) packet() (byte, []byte) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(i.reader, header)
+	assert.NoError(i.t, err)
+	assert.Equal(i.t, byte('$'), header[0])
+
+	packet := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	_, err = io.ReadFull(i.reader, packet)
+	assert.NoError(i.t, err)
+
+	return header[1], packet
+}
+
+func startServer(t *testing.T) (*server, string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cameras := camera.NewRegistry("")
+	for _, name := range []string{"bars", "porch"} {
+		cam, err := camera.New(ctx, &api.CameraOption{
+			Name:           name,
+			Source:         api.SourceTestPattern,
+			CaptureWidth:   64,
+			CaptureHeight:  48,
+			FrameRate:      25,
+			StateDirectory: t.TempDir(),
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, cameras.Add(cam))
+	}
+
+	instance := New(cameras, "127.0.0.1:0")
+	assert.NoError(t, instance.Start())
+	t.Cleanup(func() { instance.Close() })
+
+	return instance, instance.listener.Addr().String()
+}
+
+func dial(t *testing.T, address string) *client {
+	conn, err := net.Dial("tcp", address)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	return &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func Test_ServerInterleaved(t *testing.T) {
+	_, address := startServer(t)
+	rtspClient := dial(t, address)
+	location := fmt.Sprintf("rtsp://%s/porch", address)
+
+	options := rtspClient.request("OPTIONS", location)
+	assert.Equal(t, 200, options.status)
+	assert.Contains(t, options.header.Get("Public"), "DESCRIBE")
+
+	description := rtspClient.request("DESCRIBE", location)
+	assert.Equal(t, 200, description.status)
+	assert.Equal(t, "application/sdp", description.header.Get("Content-Type"))
+	assert.Equal(t, location+"/", description.header.Get("Content-Base"))
+	assert.Contains(t, description.body, "s=porch\r\n")
+	assert.Contains(t, description.body, "m=video 0 RTP/AVP 26\r\n")
+	assert.Contains(t, description.body, "a=framerate:25\r\n")
+	assert.Contains(t, description.body, "a=control:track1\r\n")
+
+	setup := rtspClient.request("SETUP", location+"/track1", "Transport: RTP/AVP/TCP;unicast;interleaved=0-1")
+	assert.Equal(t, 200, setup.status)
+	assert.Contains(t, setup.header.Get("Transport"), "interleaved=0-1")
+	session, _, _ := strings.Cut(setup.header.Get("Session"), ";")
+	assert.NotEmpty(t, session)
+
+	unknown := rtspClient.request("PLAY", location, "Session: unknown")
+	assert.Equal(t, statusSessionNotFound, unknown.status)
+
+	play := rtspClient.request("PLAY", location, "Session: "+session)
+	assert.Equal(t, 200, play.status)
+	assert.Contains(t, play.header.Get("RTP-Info"), "seq=")
+	assert.Zero(t, rtspClient.skipped, "no packet before the PLAY response")
+
+	// read packets up to the end of a complete frame
+	for {
+		channel, packet := rtspClient.packet()
+		assert.Equal(t, byte(0), channel)
+		assert.Equal(t, byte(rtpVersion<<6), packet[0])
+		assert.Equal(t, byte(rtpPayloadJPEG), packet[1]&0x7f)
+
+		payload := packet[rtpHeaderSize:]
+		assert.Equal(t, byte(8), payload[6], "width in blocks")
+		assert.Equal(t, byte(6), payload[7], "height in blocks")
+
+		if packet[1]&0x80 != 0 {
+			break
+		}
+	}
+
+	teardown := rtspClient.request("TEARDOWN", location, "Session: "+session)
+	assert.Equal(t, 200, teardown.status)
+
+	again := rtspClient.request("PLAY", location, "Session: "+session)
+	assert.Equal(t, statusSessionNotFound, again.status)
+}
+
+func Test_ServerUDP(t *testing.T) {
+	_, address := startServer(t)
+	rtspClient := dial(t, address)
+
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer receiver.Close()
+	port := receiver.LocalAddr().(*net.UDPAddr).Port
+
+	// the root path serves the default camera
+	location := fmt.Sprintf("rtsp://%s/", address)
+	setup := rtspClient.request("SETUP", location+"track1", fmt.Sprintf("Transport: RTP/AVP;unicast;client_port=%d-%d", port, port+1))
+	assert.Equal(t, 200, setup.status)
+	assert.Contains(t, setup.header.Get("Transport"), "server_port=")
+
+	play := rtspClient.request("PLAY", location, "Session: "+setup.header.Get("Session"))
+	assert.Equal(t, 200, play.status)
+
+	receiver.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet := make([]byte, 2048)
+	n, err := receiver.Read(packet)
+	assert.NoError(t, err)
+	assert.Greater(t, n, rtpHeaderSize+jpegHeaderLength)
+	assert.Equal(t, byte(rtpPayloadJPEG), packet[1]&0x7f)
+}
+
+func Test_ServerErrors(t *testing.T) {
+	_, address := startServer(t)
+	rtspClient := dial(t, address)
+
+	cases := []struct {
+		name     string
+		method   string
+		path     string
+		headers  []string
+		expected int
+	}{
+		{name: "unknown camera", method: "DESCRIBE", path: "/garage", expected: 404},
+		{name: "nested path", method: "DESCRIBE", path: "/porch/extra", expected: 404},
+		{name: "multicast", method: "SETUP", path: "/porch/track1", headers: []string{"Transport: RTP/AVP;multicast"}, expected: statusUnsupportedTransport},
+		{name: "second track", method: "SETUP", path: "/porch/track1", headers: []string{"Session: 1234", "Transport: RTP/AVP/TCP"}, expected: statusAggregateNotAllowed},
+		{name: "unknown session", method: "TEARDOWN", path: "/porch", headers: []string{"Session: 1234"}, expected: statusSessionNotFound},
+		{name: "unsupported method", method: "RECORD", path: "/porch", expected: 501},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			response := rtspClient.request(c.method, fmt.Sprintf("rtsp://%s%s", address, c.path), c.headers...)
+			assert.Equal(tt, c.expected, response.status)
+		})
+	}
+}
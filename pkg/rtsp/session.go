@@ -0,0 +1,225 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// transport is the delivery negotiated by SETUP: UDP to a pair of client ports
+// or interleaved on the RTSP connection
+type transport struct {
+	tcp         bool
+	clientPorts [2]int
+	interleaved [2]int
+}
+
+// parseTransport selects the first supported unicast alternative of the Transport header
+func parseTransport(header string) (*transport, error) {
+	for _, alternative := range strings.Split(header, ",") {
+		parameters := strings.Split(strings.TrimSpace(alternative), ";")
+
+		candidate := new(transport)
+		switch strings.ToUpper(parameters[0]) {
+		case "RTP/AVP", "RTP/AVP/UDP":
+		case "RTP/AVP/TCP":
+			candidate.tcp = true
+		default:
+			continue
+		}
+
+		supported := true
+		ports := false
+		for _, parameter := range parameters[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+			switch strings.ToLower(key) {
+			case "multicast":
+				supported = false
+			case "client_port":
+				pair, err := parsePair(value)
+				if err != nil {
+					return nil, errors.Wrap(err, "invalid client_port")
+				}
+				candidate.clientPorts = pair
+				ports = true
+			case "interleaved":
+				pair, err := parsePair(value)
+				if err != nil || pair[0] > 255 || pair[1] > 255 {
+					return nil, errors.Errorf("invalid interleaved channels \"%s\"", value)
+				}
+				candidate.interleaved = pair
+			}
+		}
+
+		if !supported || (!candidate.tcp && !ports) {
+			continue
+		}
+
+		if candidate.tcp && candidate.interleaved == [2]int{} {
+			candidate.interleaved = [2]int{0, 1}
+		}
+
+		return candidate, nil
+	}
+
+	return nil, errors.Errorf("no supported transport in \"%s\"", header)
+}
+
+// parsePair reads "a-b", a single value "a" stands for "a-(a+1)"
+func parsePair(value string) ([2]int, error) {
+	first, second, found := strings.Cut(value, "-")
+
+	a, err := strconv.Atoi(first)
+	if err != nil || a < 0 || a > 65535 {
+		return [2]int{}, errors.Errorf("invalid number \"%s\"", first)
+	}
+
+	if !found {
+		return [2]int{a, a + 1}, nil
+	}
+
+	b, err := strconv.Atoi(second)
+	if err != nil || b < 0 || b > 65535 {
+		return [2]int{}, errors.Errorf("invalid number \"%s\"", second)
+	}
+
+	return [2]int{a, b}, nil
+}
+
+// sender delivers the RTP packets of a session
+type sender interface {
+	send(packet []byte) error
+	Close() error
+	// description is the Transport header answering SETUP
+	description(ssrc uint32) string
+}
+
+func newUDPSender(remote net.IP, ports [2]int) (*udpSender, error) {
+	instance := new(udpSender)
+	instance.clientPorts = ports
+
+	var err error
+	instance.rtp, err = net.DialUDP("udp", nil, &net.UDPAddr{IP: remote, Port: ports[0]})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open RTP socket")
+	}
+
+	// no RTCP is sent, the socket reserves the port announced to the client
+	instance.rtcp, err = net.DialUDP("udp", nil, &net.UDPAddr{IP: remote, Port: ports[1]})
+	if err != nil {
+		instance.rtp.Close()
+		return nil, errors.Wrap(err, "failed to open RTCP socket")
+	}
+
+	return instance, nil
+}
+
+type udpSender struct {
+	rtp         *net.UDPConn
+	rtcp        *net.UDPConn
+	clientPorts [2]int
+}
+
+func (i *udpSender) send(packet []byte) error {
+	_, err := i.rtp.Write(packet)
+	return err
+}
+
+func (i *udpSender) Close() error {
+	i.rtcp.Close()
+	return i.rtp.Close()
+}
+
+func (i *udpSender) description(ssrc uint32) string {
+	return fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=%d-%d;ssrc=%08X",
+		i.clientPorts[0], i.clientPorts[1],
+		i.rtp.LocalAddr().(*net.UDPAddr).Port, i.rtcp.LocalAddr().(*net.UDPAddr).Port,
+		ssrc)
+}
+
+// interleavedSender writes the packets on the RTSP connection
+type interleavedSender struct {
+	connection *connection
+	channels   [2]int
+}
+
+func (i *interleavedSender) send(packet []byte) error {
+	return i.connection.writeInterleaved(byte(i.channels[0]), packet)
+}
+
+func (i *interleavedSender) Close() error {
+	return nil
+}
+
+func (i *interleavedSender) description(ssrc uint32) string {
+	return fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d;ssrc=%08X", i.channels[0], i.channels[1], ssrc)
+}
+
+// session streams a camera to a single client once playing
+type session struct {
+	id         string
+	camera     api.Camera
+	control    string
+	sender     sender
+	packetizer *packetizer
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func (i *session) playing() bool {
+	return i.cancel != nil
+}
+
+// play starts sending frames until stop is called or the delivery fails
+func (i *session) play(ctx context.Context) {
+	ctx, i.cancel = context.WithCancel(ctx)
+	i.done = make(chan struct{})
+
+	go func() {
+		defer close(i.done)
+		i.stream(ctx)
+	}()
+}
+
+func (i *session) stop() {
+	if i.playing() {
+		i.cancel()
+		<-i.done
+	}
+
+	i.sender.Close()
+}
+
+// stream sends the frames until the session stops or a send fails,
+// the subscription ends with it so that an idle camera can close
+func (i *session) stream(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	unsupported := false
+
+	for frame := range i.camera.Subscribe(ctx) {
+		image, err := parseJPEG(frame.Data)
+		if err != nil {
+			if !unsupported {
+				log.Warn().Msgf("rtsp session %s: frame %d of camera \"%s\" cannot be sent: %s", i.id, frame.Sequence, i.camera.Name(), err)
+				unsupported = true
+			}
+			continue
+		}
+
+		for _, packet := range i.packetizer.packets(image.packetize(rtpMaximumPayload), frame.Timestamp) {
+			err := i.sender.send(packet)
+			if err != nil {
+				log.Info().Msgf("rtsp session %s: stopped streaming camera \"%s\": %s", i.id, i.camera.Name(), err)
+				return
+			}
+		}
+	}
+}
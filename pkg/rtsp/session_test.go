@@ -0,0 +1,133 @@
+package rtsp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+func Test_ParseTransport(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		expected *transport
+		invalid  bool
+	}{
+		{
+			name:     "udp",
+			header:   "RTP/AVP;unicast;client_port=5000-5001",
+			expected: &transport{clientPorts: [2]int{5000, 5001}},
+		},
+		{
+			name:     "udp single port",
+			header:   "RTP/AVP/UDP;unicast;client_port=6000",
+			expected: &transport{clientPorts: [2]int{6000, 6001}},
+		},
+		{
+			name:     "interleaved",
+			header:   "RTP/AVP/TCP;unicast;interleaved=2-3",
+			expected: &transport{tcp: true, interleaved: [2]int{2, 3}},
+		},
+		{
+			name:     "interleaved default channels",
+			header:   "RTP/AVP/TCP;unicast",
+			expected: &transport{tcp: true, interleaved: [2]int{0, 1}},
+		},
+		{
+			name:     "first supported alternative",
+			header:   "RTP/AVP;multicast, RTP/SAVP;unicast;client_port=4000-4001, RTP/AVP/TCP;interleaved=0-1",
+			expected: &transport{tcp: true, interleaved: [2]int{0, 1}},
+		},
+		{
+			name:    "udp without ports",
+			header:  "RTP/AVP;unicast",
+			invalid: true,
+		},
+		{
+			name:    "invalid channels",
+			header:  "RTP/AVP/TCP;interleaved=300-301",
+			invalid: true,
+		},
+		{
+			name:    "empty",
+			header:  "",
+			invalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			negotiated, err := parseTransport(c.header)
+
+			if c.invalid {
+				assert.Error(tt, err)
+				return
+			}
+
+			assert.NoError(tt, err)
+			assert.Equal(tt, c.expected, negotiated)
+		})
+	}
+}
+
+// subscribedCamera feeds a single frame repeatedly and remembers the subscription
+type subscribedCamera struct {
+	api.Camera
+	frame        *api.Frame
+	subscription context.Context
+}
+
+func (i *subscribedCamera) Name() string {
+	return "fake"
+}
+
+func (i *subscribedCamera) Subscribe(ctx context.Context) <-chan *api.Frame {
+	i.subscription = ctx
+	frames := make(chan *api.Frame)
+
+	go func() {
+		defer close(frames)
+		for {
+			select {
+			case frames <- i.frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return frames
+}
+
+type failingSender struct {
+	sent int
+}
+
+func (i *failingSender) send(packet []byte) error {
+	i.sent++
+	return errors.New("connection reset")
+}
+
+func (i *failingSender) Close() error {
+	return nil
+}
+
+func (i *failingSender) description(ssrc uint32) string {
+	return ""
+}
+
+func Test_SessionUnsubscribesOnFailure(t *testing.T) {
+	cam := &subscribedCamera{frame: &api.Frame{Data: encodeColorImage(t, 32, 16), Timestamp: time.Now()}}
+	delivery := new(failingSender)
+	failing := &session{id: "1", camera: cam, sender: delivery, packetizer: newPacketizer()}
+
+	// the session context stays alive until TEARDOWN or the connection closes
+	failing.stream(context.Background())
+
+	assert.Equal(t, 1, delivery.sent)
+	assert.Error(t, cam.subscription.Err(), "the subscription ends with the failed stream")
+}
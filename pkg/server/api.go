@@ -0,0 +1,327 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("failed to write json response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+func (i *server) devicesServ(w http.ResponseWriter, req *http.Request) {
+	devices, err := camera.ListDevices()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, devices)
+}
+
+type controlRequest struct {
+	Value *int32 `json:"value"`
+}
+
+type wakeRequest struct {
+	Duration string `json:"duration"`
+}
+
+// errorStatus maps camera errors to HTTP status codes
+func errorStatus(err error) int {
+	if errors.Is(err, api.ErrorUnsupported) {
+		return http.StatusNotImplemented
+	}
+
+	if errors.Is(err, api.ErrorOffline) {
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, api.ErrorInvalidState) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, api.ErrorInvalidResolution) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (i *server) controlsServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	controls, err := cam.Controls()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, controls)
+}
+
+func (i *server) setControlServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body := new(controlRequest)
+	err = json.NewDecoder(req.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "failed to parse request body"))
+		return
+	}
+
+	if body.Value == nil {
+		writeError(w, http.StatusBadRequest, errors.New("missing control value"))
+		return
+	}
+
+	controls, err := cam.Controls()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	control, err := camera.FindControl(controls, req.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if *body.Value < control.Minimum || *body.Value > control.Maximum {
+		writeError(w, http.StatusBadRequest, errors.Errorf("value %d of control \"%s\" is out of range [%d, %d]", *body.Value, control.Key, control.Minimum, control.Maximum))
+		return
+	}
+
+	err = cam.SetControl(control.ID, *body.Value)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	log.Info().Msgf("camera \"%s\": control \"%s\" set to %d", cam.Name(), control.Key, *body.Value)
+
+	control.Value = *body.Value
+	writeJSON(w, http.StatusOK, control)
+}
+
+func (i *server) status(cam api.Camera) *api.CameraStatus {
+	return &api.CameraStatus{
+		Name:    cam.Name(),
+		State:   cam.State(),
+		Viewers: i.viewers.count(cam.Name()),
+	}
+}
+
+func (i *server) camerasServ(w http.ResponseWriter, req *http.Request) {
+	defaultCamera, err := i.cameras.Default()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	statuses := make([]*api.CameraStatus, 0)
+	for _, name := range i.cameras.Names() {
+		cam, err := i.cameras.Get(name)
+		if err != nil {
+			continue
+		}
+
+		status := i.status(cam)
+		status.Default = cam.Name() == defaultCamera.Name()
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (i *server) stateServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, i.status(cam))
+}
+
+// transitionServ applies one of the start, stop, pause and resume
+// actions and answers with the resulting state
+func (i *server) transitionServ(action func(api.Camera) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cam, err := i.camera(req)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+
+		err = action(cam)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, i.status(cam))
+	}
+}
+
+// roiResponse always holds a region, the full frame when no zoom is applied
+func roiResponse(roi *api.ROI) *api.ROI {
+	if roi == nil {
+		return &api.ROI{Width: 1, Height: 1}
+	}
+
+	return roi
+}
+
+func (i *server) roiServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roiResponse(cam.ROI()))
+}
+
+func (i *server) setROIServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body := new(api.ROI)
+	err = json.NewDecoder(req.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "failed to parse request body"))
+		return
+	}
+
+	err = camera.ValidateROI(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = cam.SetROI(body)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	log.Info().Msgf("camera \"%s\": region of interest set to %g,%g %gx%g", cam.Name(), body.X, body.Y, body.Width, body.Height)
+
+	writeJSON(w, http.StatusOK, roiResponse(cam.ROI()))
+}
+
+func (i *server) resolutionServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	resolution, err := cam.Resolution()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resolution)
+}
+
+func (i *server) setResolutionServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body := new(api.Resolution)
+	err = json.NewDecoder(req.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "failed to parse request body"))
+		return
+	}
+
+	err = cam.SetResolution(body.Width, body.Height)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &api.Resolution{Width: body.Width, Height: body.Height})
+}
+
+func (i *server) pipelineServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cam.Pipeline())
+}
+
+func (i *server) healthServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cam.Health())
+}
+
+// wakeServ keeps an idle camera open for the requested duration, like "5m"
+func (i *server) wakeServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body := new(wakeRequest)
+	err = json.NewDecoder(req.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "failed to parse request body"))
+		return
+	}
+
+	duration, err := time.ParseDuration(body.Duration)
+	if err != nil || duration <= 0 {
+		writeError(w, http.StatusBadRequest, errors.Errorf("duration must be positive, got \"%s\"", body.Duration))
+		return
+	}
+
+	cam.Wake(duration)
+
+	writeJSON(w, http.StatusOK, i.status(cam))
+}
@@ -9,93 +9,364 @@ import (
 	"net"
 	"net/http"
 	"net/textproto"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
 	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+	"github.com/ylallemant/go-picam-streamer/pkg/rtsp"
 )
 
-func New(serverOptions *api.ServerOptions, cameraOptions *api.CameraOption) (*server, error) {
+func New(serverOptions *api.ServerOptions, cameraOptions []*api.CameraOption) (*server, error) {
+	svr := newServer(serverOptions, camera.NewRegistry(serverOptions.DefaultCamera))
+
+	for _, options := range cameraOptions {
+		cam, err := camera.New(svr.ctx, options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open camera \"%s\"", options.Name)
+		}
+
+		err = svr.cameras.Add(cam)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to register camera")
+		}
+
+		log.Info().Msgf("camera \"%s\" started on %s", cam.Name(), cam.Description())
+	}
+
+	if _, err := svr.cameras.Default(); err != nil {
+		return nil, errors.Wrap(err, "failed to resolve default camera")
+	}
+
+	err := svr.routes()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverOptions.RTSPPort != "" {
+		svr.rtspAddress = fmt.Sprintf("%s:%s", svr.binding, serverOptions.RTSPPort)
+		svr.rtsp = rtsp.New(svr.cameras, svr.rtspAddress)
+	}
+
+	return svr, nil
+}
+
+func newServer(serverOptions *api.ServerOptions, cameras api.Registry) *server {
 	svr := new(server)
 	svr.mux = http.NewServeMux()
 	svr.port = serverOptions.Port
 	svr.binding = serverOptions.Address
+	svr.cameras = cameras
+	svr.viewers = newViewers()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	svr.ctx = ctx
 	svr.cancelFunc = cancel
 
-	cam, err := camera.New(svr.ctx, cameraOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to open camera device")
-	}
+	// streams end before the cameras stop so that viewers get a complete last part
+	svr.streams, svr.endStreams = context.WithCancel(context.Background())
 
-	svr.camera = cam
-	log.Info().Msgf("camera started")
-	svr.frames = svr.camera.ReadFrames()
+	return svr
+}
 
+// routes registers the handlers of the pages, streams and API
+func (i *server) routes() error {
 	var staticFS = fs.FS(staticFiles)
 	htmlContent, err := fs.Sub(staticFS, "static")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed mount static files")
+		return errors.Wrap(err, "failed mount static files")
 	}
 	fileserver := http.FileServer(http.FS(htmlContent))
 
-	svr.mux.Handle("/", fileserver)
-	svr.mux.HandleFunc("/stream", svr.imageServ)
+	i.mux.Handle("/", fileserver)
+	i.mux.HandleFunc("/stream", i.imageServ)
+	i.mux.HandleFunc("/stream/{name}", i.imageServ)
+	i.mux.HandleFunc("/stream/{name}/sub", i.subImageServ)
+	i.mux.HandleFunc("GET /ws/stream", i.websocketServ)
+	i.mux.HandleFunc("GET /ws/stream/{name}", i.websocketServ)
+	i.mux.HandleFunc("GET /snapshot", i.snapshotServ)
+	i.mux.HandleFunc("GET /snapshot/{name}", i.snapshotServ)
+	i.mux.HandleFunc("GET /snapshot/{name}/sub", i.subSnapshotServ)
+	i.mux.HandleFunc("GET /api/devices", i.devicesServ)
+	i.mux.HandleFunc("GET /api/cameras", i.camerasServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/controls", i.controlsServ)
+	i.mux.HandleFunc("PUT /api/cameras/{name}/controls/{id}", i.setControlServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/resolution", i.resolutionServ)
+	i.mux.HandleFunc("PUT /api/cameras/{name}/resolution", i.setResolutionServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/pipeline", i.pipelineServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/health", i.healthServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/roi", i.roiServ)
+	i.mux.HandleFunc("PUT /api/cameras/{name}/roi", i.setROIServ)
+	i.mux.HandleFunc("GET /api/cameras/{name}/state", i.stateServ)
+	i.mux.HandleFunc("POST /api/cameras/{name}/start", i.transitionServ(api.Camera.Start))
+	i.mux.HandleFunc("POST /api/cameras/{name}/stop", i.transitionServ(api.Camera.Stop))
+	i.mux.HandleFunc("POST /api/cameras/{name}/pause", i.transitionServ(api.Camera.Pause))
+	i.mux.HandleFunc("POST /api/cameras/{name}/resume", i.transitionServ(api.Camera.Resume))
+	i.mux.HandleFunc("POST /api/cameras/{name}/wake", i.wakeServ)
 
-	svr.http = &http.Server{
-		Handler: svr.mux,
+	i.http = &http.Server{
+		Handler: i.mux,
 	}
 
-	return svr, nil
+	return nil
 }
 
+// streamWriteTimeout drops viewers which stopped reading
+const streamWriteTimeout = 10 * time.Second
+
+// bounds of the frame rate requested by a viewer
+const (
+	minimumViewerFrameRate = 0.01
+	maximumViewerFrameRate = 1000.0
+)
+
 //go:embed static
 var staticFiles embed.FS
 
 type server struct {
 	http       *http.Server
 	mux        *http.ServeMux
-	camera     api.Camera
+	rtsp       rtspServer
+	cameras    api.Registry
+	viewers    *viewers
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+	streams    context.Context
+	endStreams context.CancelFunc
 	port       string
 	binding    string
-	frames     <-chan []byte
+	// rtspAddress is empty when RTSP is disabled
+	rtspAddress string
+}
+
+type rtspServer interface {
+	Start() error
+	Close() error
 }
 
 func (i *server) Start() error {
 	addr := fmt.Sprintf("%s:%s", i.binding, i.port)
 
+	if i.rtsp != nil {
+		err := i.rtsp.Start()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range i.cameras.Names() {
+			log.Info().Msgf("Serving RTSP: [rtsp://%s/%s]", i.rtspAddress, name)
+		}
+	}
+
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return errors.Wrapf(err, "failed to initiate listener on %s", addr)
 	}
 
+	for _, name := range i.cameras.Names() {
+		log.Info().Msgf("Serving images: [%s/stream/%s]", addr, name)
+		log.Info().Msgf("Serving images: [%s/stream/%s/sub]", addr, name)
+	}
 	log.Info().Msgf("Serving images: [%s/stream]", addr)
-	return i.http.Serve(listener)
+
+	return i.serve(listener)
+}
+
+// serve handles requests until the server is shut down
+func (i *server) serve(listener net.Listener) error {
+	err := i.http.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Shutdown ends the streams, waits for the other requests to complete
+// and closes the devices, requests still running at the deadline are cut off
+func (i *server) Shutdown(ctx context.Context) error {
+	log.Info().Msg("shutting down")
+
+	i.endStreams()
+
+	err := i.http.Shutdown(ctx)
+	if err != nil {
+		log.Warn().Msgf("requests cut off: %s", err)
+		i.http.Close()
+	}
+
+	if i.rtsp != nil {
+		err := i.rtsp.Close()
+		if err != nil {
+			log.Warn().Msgf("failed to close RTSP listener: %s", err)
+		}
+	}
+
+	i.cancelFunc()
+
+	for _, name := range i.cameras.Names() {
+		cam, err := i.cameras.Get(name)
+		if err != nil {
+			continue
+		}
+
+		if err := cam.Stop(); err != nil {
+			log.Warn().Msgf("failed to stop camera \"%s\": %s", name, err)
+		}
+	}
+
+	log.Info().Msg("shutdown complete")
+
+	return nil
+}
+
+// camera resolves the camera named in the request path,
+// falling back to the default camera
+func (i *server) camera(req *http.Request) (api.Camera, error) {
+	name := req.PathValue("name")
+	if name == "" {
+		return i.cameras.Default()
+	}
+
+	return i.cameras.Get(name)
 }
 
 func (i *server) imageServ(w http.ResponseWriter, req *http.Request) {
-	log.Info().Msgf("request stream")
+	cam, err := i.camera(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	frameRate, err := frameRateParameter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Msgf("request stream of camera \"%s\"", cam.Name())
+	i.streamFrames(w, req, cam, cam.Subscribe(req.Context()), frameRate)
+}
+
+func (i *server) subImageServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	frameRate, err := frameRateParameter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Msgf("request sub stream of camera \"%s\"", cam.Name())
+	i.streamFrames(w, req, cam, cam.SubStream().Subscribe(req.Context()), frameRate)
+}
+
+// streamFrames writes the frames as a multipart MJPEG stream until the feed closes,
+// the viewer disconnects, a write fails or times out, or the server shuts down
+func (i *server) streamFrames(w http.ResponseWriter, req *http.Request, cam api.Camera, frames <-chan *api.Frame, frameRate float64) {
 	mimeWriter := multipart.NewWriter(w)
 	w.Header().Set("Content-Type", fmt.Sprintf("multipart/x-mixed-replace; boundary=%s", mimeWriter.Boundary()))
 	partHeader := make(textproto.MIMEHeader)
 	partHeader.Add("Content-Type", "image/jpeg")
 
-	var frame []byte
-	for frame = range i.frames {
-		log.Trace().Msgf("process frame")
-		partWriter, err := mimeWriter.CreatePart(partHeader)
-		if err != nil {
-			log.Printf("failed to create multi-part writer: %s", err)
+	controller := http.NewResponseController(w)
+	throttle := broadcast.NewThrottle(frameRate)
+	written := 0
+
+	log.Info().Msgf("viewer %s connected to camera \"%s\", %d active", req.RemoteAddr, cam.Name(), i.viewers.add(cam.Name()))
+	defer func() {
+		log.Info().Msgf("viewer %s left camera \"%s\" after %d frames, %d active", req.RemoteAddr, cam.Name(), written, i.viewers.remove(cam.Name()))
+	}()
+
+	for {
+		var frame *api.Frame
+		var ok bool
+
+		select {
+		case <-req.Context().Done():
 			return
+		case <-i.streams.Done():
+			// the closing boundary tells the viewer the stream ended
+			mimeWriter.Close()
+			return
+		case frame, ok = <-frames:
+			if !ok {
+				mimeWriter.Close()
+				return
+			}
 		}
 
-		if _, err := partWriter.Write(frame); err != nil {
-			log.Printf("failed to write image: %s", err)
+		if !throttle.Allow(time.Now()) {
+			continue
 		}
+
+		log.Trace().Msgf("process frame %d", frame.Sequence)
+		partHeader.Set("Content-Length", strconv.Itoa(len(frame.Data)))
+		partHeader.Set(mjpeg.HeaderTimestamp, mjpeg.FormatTimestamp(frame.Timestamp))
+		partHeader.Set(mjpeg.HeaderSequence, strconv.FormatUint(uint64(frame.Sequence), 10))
+
+		err := writePart(controller, mimeWriter, partHeader, frame.Data)
+		if err != nil {
+			log.Debug().Msgf("failed to write frame %d to %s: %s", frame.Sequence, req.RemoteAddr, err)
+			return
+		}
+
+		written = written + 1
 	}
 }
+
+// writePart sends a single image, a peer not accepting it
+// within the write timeout is dropped
+func writePart(controller *http.ResponseController, mimeWriter *multipart.Writer, header textproto.MIMEHeader, data []byte) error {
+	err := controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errors.Wrap(err, "failed to set write deadline")
+	}
+
+	partWriter, err := mimeWriter.CreatePart(header)
+	if err != nil {
+		return errors.Wrap(err, "failed to create part")
+	}
+
+	_, err = partWriter.Write(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to write image")
+	}
+
+	err = controller.Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errors.Wrap(err, "failed to flush part")
+	}
+
+	return nil
+}
+
+// frameRateParameter reads the optional "fps" query parameter
+// limiting the frame rate of a single viewer
+func frameRateParameter(req *http.Request) (float64, error) {
+	value := req.URL.Query().Get("fps")
+	if value == "" {
+		return 0, nil
+	}
+
+	frameRate, err := strconv.ParseFloat(value, 64)
+	if err != nil || !validFrameRate(frameRate) {
+		return 0, errors.Errorf("fps must be a number between %g and %g, got \"%s\"", minimumViewerFrameRate, maximumViewerFrameRate, value)
+	}
+
+	return frameRate, nil
+}
+
+// validFrameRate bounds the frame rate of a viewer, smaller rates
+// would overflow the throttle interval, NaN and infinities fail both bounds
+func validFrameRate(frameRate float64) bool {
+	return frameRate >= minimumViewerFrameRate && frameRate <= maximumViewerFrameRate
+}
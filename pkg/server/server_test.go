@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+)
+
+const (
+	fakeWidth  = 64
+	fakeHeight = 48
+	// fakeFrameInterval is the frame rate of the fake cameras
+	fakeFrameInterval = 20 * time.Millisecond
+)
+
+// fakeCamera publishes a color image at a steady rate,
+// the methods the tests do not need panic through the embedded interface
+type fakeCamera struct {
+	api.Camera
+	name        string
+	options     *api.CameraOption
+	broadcaster api.CachingBroadcaster
+	mutex       sync.Mutex
+	state       string
+	stops       int
+}
+
+func newFakeCamera(t *testing.T, name string) *fakeCamera {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	src := image.NewRGBA(image.Rect(0, 0, fakeWidth, fakeHeight))
+	for x := 0; x < fakeWidth; x++ {
+		for y := 0; y < fakeHeight; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: 128, A: 255})
+		}
+	}
+
+	data := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(data, src, &jpeg.Options{Quality: 95}))
+
+	feed := make(chan *api.Frame)
+	go func() {
+		defer close(feed)
+
+		ticker := time.NewTicker(fakeFrameInterval)
+		defer ticker.Stop()
+
+		for sequence := uint32(1); ; sequence++ {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				select {
+				case feed <- &api.Frame{Data: data.Bytes(), Timestamp: now, Sequence: sequence, Width: fakeWidth, Height: fakeHeight}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return &fakeCamera{
+		name:        name,
+		options:     &api.CameraOption{Name: name, JPEGQuality: api.DefaultJPEGQuality},
+		broadcaster: broadcast.New(ctx, feed),
+		state:       api.CameraStateRunning,
+	}
+}
+
+func (i *fakeCamera) Name() string {
+	return i.name
+}
+
+func (i *fakeCamera) Options() *api.CameraOption {
+	return i.options
+}
+
+func (i *fakeCamera) Subscribe(ctx context.Context) <-chan *api.Frame {
+	return i.broadcaster.Subscribe(ctx)
+}
+
+func (i *fakeCamera) Snapshot(ctx context.Context) (*api.Frame, error) {
+	frame, ok := <-i.broadcaster.Subscribe(ctx)
+	if !ok {
+		return nil, ctx.Err()
+	}
+
+	return frame, nil
+}
+
+func (i *fakeCamera) State() string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.state
+}
+
+func (i *fakeCamera) setState(state string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.state = state
+}
+
+func (i *fakeCamera) Stop() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.state = api.CameraStateStopped
+	i.stops = i.stops + 1
+
+	return nil
+}
+
+func (i *fakeCamera) stopped() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.stops
+}
+
+// startServer serves the cameras on a local port, the first one is the default camera.
+// The returned channel receives the result of serve once the server is shut down
+func startServer(t *testing.T, cameras ...api.Camera) (*server, string, <-chan error) {
+	registry := camera.NewRegistry("")
+	for _, cam := range cameras {
+		assert.NoError(t, registry.Add(cam))
+	}
+
+	svr := newServer(&api.ServerOptions{}, registry)
+	assert.NoError(t, svr.routes())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- svr.serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		svr.http.Close()
+		svr.endStreams()
+		svr.cancelFunc()
+	})
+
+	return svr, "http://" + listener.Addr().String(), served
+}
+
+func get(t *testing.T, url string) *http.Response {
+	res, err := http.Get(url)
+	assert.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func Test_Shutdown(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	porch := newFakeCamera(t, "porch")
+	svr, base, served := startServer(t, bars, porch)
+
+	res := get(t, base+"/stream/porch")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, parameters, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	parts := multipart.NewReader(res.Body, parameters["boundary"])
+
+	part, err := parts.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", part.Header.Get("Content-Type"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, svr.Shutdown(ctx))
+	assert.NoError(t, <-served)
+
+	// the stream ends with the closing boundary rather than a cut connection
+	for err == nil {
+		_, err = parts.NextPart()
+	}
+	assert.Equal(t, io.EOF, err)
+
+	assert.Equal(t, 1, bars.stopped())
+	assert.Equal(t, 1, porch.stopped())
+
+	_, err = http.Get(base + "/snapshot")
+	assert.Error(t, err, "no request is accepted after shutdown")
+}
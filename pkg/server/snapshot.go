@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/camera"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+)
+
+// snapshotRequest holds the optional query parameters of a snapshot
+type snapshotRequest struct {
+	// Width downscales the image keeping its aspect ratio
+	Width int
+	// Quality re-encodes the image, the camera quality is used when only the width is set
+	Quality int
+	// Download serves the image as an attachment
+	Download bool
+}
+
+func snapshotParameters(req *http.Request) (*snapshotRequest, error) {
+	query := req.URL.Query()
+	parameters := new(snapshotRequest)
+
+	if value := query.Get("width"); value != "" {
+		width, err := strconv.Atoi(value)
+		if err != nil || width <= 0 {
+			return nil, errors.Errorf("width must be a positive integer, got \"%s\"", value)
+		}
+		parameters.Width = width
+	}
+
+	if value := query.Get("quality"); value != "" {
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			return nil, errors.Errorf("quality must be between 1 and 100, got \"%s\"", value)
+		}
+		parameters.Quality = quality
+	}
+
+	if value := query.Get("download"); value != "" {
+		download, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Errorf("download must be true or false, got \"%s\"", value)
+		}
+		parameters.Download = download
+	}
+
+	return parameters, nil
+}
+
+func (i *server) snapshotServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	parameters, err := snapshotParameters(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Msgf("request snapshot of camera \"%s\"", cam.Name())
+
+	frame, ok := i.latestFrame(w, req, cam)
+	if !ok {
+		return
+	}
+
+	if parameters.Width > 0 || parameters.Quality > 0 {
+		quality := parameters.Quality
+		if quality == 0 {
+			quality = cam.Options().JPEGQuality
+		}
+		if quality == 0 {
+			quality = api.DefaultJPEGQuality
+		}
+
+		frame, err = camera.ResizeFrame(frame, parameters.Width, 0, quality)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to resize snapshot: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeSnapshot(w, cam, frame, parameters.Download)
+}
+
+func (i *server) subSnapshotServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	parameters, err := snapshotParameters(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Msgf("request sub snapshot of camera \"%s\"", cam.Name())
+
+	frame, ok := i.latestFrame(w, req, cam)
+	if !ok {
+		return
+	}
+
+	resized, err := cam.SubStream().Resize(frame)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resize snapshot: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeSnapshot(w, cam, resized, parameters.Download)
+}
+
+// latestFrame returns a recent frame of the camera, an error response is written
+// when none is available, the wait ends when the server shuts down
+func (i *server) latestFrame(w http.ResponseWriter, req *http.Request, cam api.Camera) (*api.Frame, bool) {
+	if state := cam.State(); state == api.CameraStatePaused || state == api.CameraStateStopped {
+		http.Error(w, fmt.Sprintf("camera \"%s\" is %s", cam.Name(), state), http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	stop := context.AfterFunc(i.streams, cancel)
+	defer stop()
+
+	frame, err := cam.Snapshot(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("no frame available from camera \"%s\": %s", cam.Name(), err), http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	return frame, true
+}
+
+// writeSnapshot serves the frame as an image which must not be cached,
+// the capture time is carried by the timestamp and last modified headers
+func writeSnapshot(w http.ResponseWriter, cam api.Camera, frame *api.Frame, download bool) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(frame.Data)))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "0")
+	w.Header().Set("Last-Modified", frame.Timestamp.UTC().Format(http.TimeFormat))
+	w.Header().Set(mjpeg.HeaderTimestamp, mjpeg.FormatTimestamp(frame.Timestamp))
+	w.Header().Set(mjpeg.HeaderSequence, strconv.FormatUint(uint64(frame.Sequence), 10))
+
+	if download {
+		filename := fmt.Sprintf("%s-%s.jpg", cam.Name(), frame.Timestamp.UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	}
+
+	if _, err := w.Write(frame.Data); err != nil {
+		log.Printf("failed to write snapshot: %s", err)
+	}
+}
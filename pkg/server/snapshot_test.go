@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/mjpeg"
+)
+
+func Test_Snapshot(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	porch := newFakeCamera(t, "porch")
+	_, base, _ := startServer(t, bars, porch)
+
+	original, err := io.ReadAll(get(t, base+"/snapshot").Body)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		path       string
+		status     int
+		width      int
+		height     int
+		smaller    bool
+		attachment string
+	}{
+		{name: "default camera", path: "/snapshot", status: http.StatusOK, width: fakeWidth, height: fakeHeight},
+		{name: "named camera", path: "/snapshot/porch", status: http.StatusOK, width: fakeWidth, height: fakeHeight},
+		{name: "resized", path: "/snapshot/bars?width=32", status: http.StatusOK, width: 32, height: 24, smaller: true},
+		{name: "never upscaled", path: "/snapshot/bars?width=640", status: http.StatusOK, width: fakeWidth, height: fakeHeight},
+		{name: "quality", path: "/snapshot/bars?quality=10", status: http.StatusOK, width: fakeWidth, height: fakeHeight, smaller: true},
+		{name: "download", path: "/snapshot/porch?download=true", status: http.StatusOK, width: fakeWidth, height: fakeHeight, attachment: "attachment; filename=\"porch-"},
+		{name: "invalid width", path: "/snapshot?width=0", status: http.StatusBadRequest},
+		{name: "invalid quality", path: "/snapshot?quality=101", status: http.StatusBadRequest},
+		{name: "invalid download", path: "/snapshot?download=maybe", status: http.StatusBadRequest},
+		{name: "unknown camera", path: "/snapshot/garage", status: http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			res := get(tt, base+c.path)
+			assert.Equal(tt, c.status, res.StatusCode)
+
+			if c.status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(tt, "image/jpeg", res.Header.Get("Content-Type"))
+			assert.Contains(tt, res.Header.Get("Cache-Control"), "no-store")
+			assert.NotEmpty(tt, res.Header.Get("Last-Modified"))
+			assert.NotEmpty(tt, res.Header.Get(mjpeg.HeaderTimestamp))
+			assert.True(tt, strings.HasPrefix(res.Header.Get("Content-Disposition"), c.attachment))
+			if c.attachment == "" {
+				assert.Empty(tt, res.Header.Get("Content-Disposition"))
+			}
+
+			data, err := io.ReadAll(res.Body)
+			assert.NoError(tt, err)
+
+			config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			assert.NoError(tt, err)
+			assert.Equal(tt, c.width, config.Width)
+			assert.Equal(tt, c.height, config.Height)
+
+			if c.smaller {
+				assert.Less(tt, len(data), len(original))
+			}
+		})
+	}
+}
+
+func Test_SnapshotUnavailable(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	_, base, _ := startServer(t, bars)
+
+	for _, state := range []string{api.CameraStatePaused, api.CameraStateStopped} {
+		bars.setState(state)
+		res := get(t, base+"/snapshot")
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, state)
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import "sync"
+
+// viewers counts the active streams of each camera
+type viewers struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func newViewers() *viewers {
+	return &viewers{counts: make(map[string]int)}
+}
+
+func (i *viewers) add(camera string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.counts[camera] = i.counts[camera] + 1
+	return i.counts[camera]
+}
+
+func (i *viewers) remove(camera string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.counts[camera] = i.counts[camera] - 1
+	return i.counts[camera]
+}
+
+func (i *viewers) count(camera string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.counts[camera]
+}
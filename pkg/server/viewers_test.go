@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+)
+
+// openStream connects a viewer and waits for its first frame
+func openStream(t *testing.T, ctx context.Context, url string) *multipart.Reader {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	_, parameters, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+
+	parts := multipart.NewReader(res.Body, parameters["boundary"])
+	_, err = parts.NextPart()
+	assert.NoError(t, err)
+
+	return parts
+}
+
+// viewerCounts returns the viewers of every camera listed by the API
+func viewerCounts(t *testing.T, base string) map[string]int {
+	statuses := make([]*api.CameraStatus, 0)
+	assert.NoError(t, json.NewDecoder(get(t, base+"/api/cameras").Body).Decode(&statuses))
+
+	counts := make(map[string]int)
+	for _, status := range statuses {
+		counts[status.Name] = status.Viewers
+	}
+
+	return counts
+}
+
+// waitForViewers returns the counts once they match or after a second
+func waitForViewers(t *testing.T, base string, expected map[string]int) map[string]int {
+	counts := viewerCounts(t, base)
+	for range 100 {
+		if assert.ObjectsAreEqual(expected, counts) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+		counts = viewerCounts(t, base)
+	}
+
+	return counts
+}
+
+func Test_Viewers(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	porch := newFakeCamera(t, "porch")
+	_, base, _ := startServer(t, bars, porch)
+
+	first, leaveFirst := context.WithCancel(context.Background())
+	defer leaveFirst()
+	second, leaveSecond := context.WithCancel(context.Background())
+	defer leaveSecond()
+
+	openStream(t, first, base+"/stream/bars")
+	parts := openStream(t, second, base+"/stream?fps=10")
+	openStream(t, context.Background(), base+"/stream/porch")
+
+	expected := map[string]int{"bars": 2, "porch": 1}
+	assert.Equal(t, expected, waitForViewers(t, base, expected))
+
+	// a throttled viewer keeps receiving frames
+	_, err := parts.NextPart()
+	assert.NoError(t, err)
+
+	leaveFirst()
+	expected = map[string]int{"bars": 1, "porch": 1}
+	assert.Equal(t, expected, waitForViewers(t, base, expected), "disconnected viewers are dropped")
+
+	leaveSecond()
+	expected = map[string]int{"bars": 0, "porch": 1}
+	assert.Equal(t, expected, waitForViewers(t, base, expected))
+}
+
+func Test_StreamFrameRateParameter(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	_, base, _ := startServer(t, bars)
+
+	for _, value := range []string{"0", "-1", "fast", "NaN", "Inf", "-Inf", "1e-300", "1001"} {
+		res := get(t, base+"/stream?fps="+value)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, value)
+	}
+
+	for _, value := range []string{"0.5", "1000"} {
+		res := get(t, base+"/stream?fps="+value)
+		assert.Equal(t, http.StatusOK, res.StatusCode, value)
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ylallemant/go-picam-streamer/pkg/api"
+	"github.com/ylallemant/go-picam-streamer/pkg/broadcast"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// websocketPingInterval keeps idle connections and proxies alive
+	websocketPingInterval = 20 * time.Second
+	// websocketMaximumMessageSize bounds the viewer commands
+	websocketMaximumMessageSize = 4 << 10
+)
+
+// frame header of the binary messages, big endian: version, flags, header length,
+// sequence, capture and send time in unix milliseconds, width and height
+const (
+	websocketHeaderVersion   = 1
+	websocketHeaderLength    = 28
+	websocketFlagPlaceholder = 1 << 0
+)
+
+const (
+	websocketCommandFrameRate = "fps"
+	websocketCommandPause     = "pause"
+	websocketCommandResume    = "resume"
+	websocketCommandPing      = "ping"
+	websocketMessagePong      = "pong"
+)
+
+// websocketMessage is a text message, commands sent by the viewer:
+// {"type": "fps", "fps": 5}, {"type": "pause"}, {"type": "resume"} and {"type": "ping", "time": <ms>},
+// the latter is answered with {"type": "pong", "time": <ms>, "server": <ms>} to measure the latency
+type websocketMessage struct {
+	Type      string  `json:"type"`
+	FrameRate float64 `json:"fps,omitempty"`
+	Time      float64 `json:"time,omitempty"`
+	Server    float64 `json:"server,omitempty"`
+}
+
+func (i *server) websocketServ(w http.ResponseWriter, req *http.Request) {
+	cam, err := i.camera(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	frameRate, err := frameRateParameter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Msgf("request websocket stream of camera \"%s\"", cam.Name())
+
+	handler := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = websocketMaximumMessageSize
+			i.streamWebsocket(ws, req, cam, frameRate)
+		},
+	}
+	handler.ServeHTTP(w, req)
+}
+
+// sameOrigin rejects connections opened by pages of other sites, which could otherwise
+// read the video from the browser of a visitor. Clients sending no origin are not browsers
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return errors.Wrap(err, "invalid origin")
+	}
+
+	if origin != nil && !strings.EqualFold(origin.Host, req.Host) {
+		return errors.Errorf("cross-origin request from %s", origin)
+	}
+
+	config.Origin = origin
+
+	return nil
+}
+
+// streamWebsocket sends every frame as a binary message until the viewer disconnects,
+// a write fails or times out, or the server shuts down. Frames are not read while paused
+func (i *server) streamWebsocket(ws *websocket.Conn, req *http.Request, cam api.Camera, frameRate float64) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	commands := make(chan *websocketMessage, 4)
+	go readWebsocketCommands(ctx, cancel, ws, commands)
+
+	throttle := broadcast.NewThrottle(frameRate)
+	written := 0
+
+	log.Info().Msgf("viewer %s connected to camera \"%s\" over websocket, %d active", req.RemoteAddr, cam.Name(), i.viewers.add(cam.Name()))
+	defer func() {
+		log.Info().Msgf("viewer %s left camera \"%s\" after %d frames, %d active", req.RemoteAddr, cam.Name(), written, i.viewers.remove(cam.Name()))
+	}()
+
+	subscription, unsubscribe := context.WithCancel(ctx)
+	frames := cam.Subscribe(subscription)
+
+	ping := time.NewTicker(websocketPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-ctx.Done():
+			unsubscribe()
+			return
+		case <-i.streams.Done():
+			unsubscribe()
+			ws.Close()
+			return
+		case <-ping.C:
+			err = sendWebsocket(ws, websocket.PingFrame, nil)
+		case command := <-commands:
+			switch command.Type {
+			case websocketCommandFrameRate:
+				// zero lifts the limit
+				if command.FrameRate != 0 && !validFrameRate(command.FrameRate) {
+					log.Debug().Msgf("viewer %s sent invalid frame rate %g", req.RemoteAddr, command.FrameRate)
+					break
+				}
+				throttle = broadcast.NewThrottle(command.FrameRate)
+			case websocketCommandPause:
+				if frames != nil {
+					unsubscribe()
+					frames = nil
+				}
+			case websocketCommandResume:
+				if frames == nil {
+					subscription, unsubscribe = context.WithCancel(ctx)
+					frames = cam.Subscribe(subscription)
+				}
+			case websocketCommandPing:
+				pong := &websocketMessage{Type: websocketMessagePong, Time: command.Time, Server: unixMilliseconds(time.Now())}
+				err = sendWebsocketJSON(ws, pong)
+			default:
+				log.Debug().Msgf("viewer %s sent unknown command \"%s\"", req.RemoteAddr, command.Type)
+			}
+		case frame, ok := <-frames:
+			if !ok {
+				unsubscribe()
+				ws.Close()
+				return
+			}
+
+			if !throttle.Allow(time.Now()) {
+				continue
+			}
+
+			err = sendWebsocket(ws, websocket.BinaryFrame, websocketFrame(frame, time.Now()))
+			written = written + 1
+		}
+
+		if err != nil {
+			log.Debug().Msgf("failed to write to websocket of %s: %s", req.RemoteAddr, err)
+			unsubscribe()
+			return
+		}
+	}
+}
+
+// readWebsocketCommands forwards the viewer commands, the stream ends once the viewer left
+func readWebsocketCommands(ctx context.Context, cancel context.CancelFunc, ws *websocket.Conn, commands chan<- *websocketMessage) {
+	defer cancel()
+
+	for {
+		command := new(websocketMessage)
+		err := websocket.JSON.Receive(ws, command)
+		if err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				continue
+			}
+			return
+		}
+
+		select {
+		case commands <- command:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendWebsocket is only called from the streaming loop, which owns the payload type
+func sendWebsocket(ws *websocket.Conn, payloadType byte, data []byte) error {
+	err := ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	ws.PayloadType = payloadType
+	_, err = ws.Write(data)
+
+	return err
+}
+
+func sendWebsocketJSON(ws *websocket.Conn, message *websocketMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return sendWebsocket(ws, websocket.TextFrame, data)
+}
+
+// websocketFrame prefixes the JPEG image with the frame header
+func websocketFrame(frame *api.Frame, now time.Time) []byte {
+	message := make([]byte, websocketHeaderLength, websocketHeaderLength+len(frame.Data))
+
+	message[0] = websocketHeaderVersion
+	if frame.Placeholder {
+		message[1] = message[1] | websocketFlagPlaceholder
+	}
+	binary.BigEndian.PutUint16(message[2:], websocketHeaderLength)
+	binary.BigEndian.PutUint32(message[4:], frame.Sequence)
+	binary.BigEndian.PutUint64(message[8:], math.Float64bits(unixMilliseconds(frame.Timestamp)))
+	binary.BigEndian.PutUint64(message[16:], math.Float64bits(unixMilliseconds(now)))
+	binary.BigEndian.PutUint16(message[24:], uint16(frame.Width))
+	binary.BigEndian.PutUint16(message[26:], uint16(frame.Height))
+
+	return append(message, frame.Data...)
+}
+
+func unixMilliseconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/jpeg"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func dialWebsocket(t *testing.T, base, path, origin string) (*websocket.Conn, error) {
+	ws, err := websocket.Dial(strings.Replace(base, "http://", "ws://", 1)+path, "", origin)
+	if err == nil {
+		t.Cleanup(func() { ws.Close() })
+		ws.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	return ws, err
+}
+
+// receiveText returns the next text message, binary frames are counted
+func receiveText(t *testing.T, ws *websocket.Conn) (*websocketMessage, int) {
+	frames := 0
+
+	for {
+		var data []byte
+		assert.NoError(t, websocket.Message.Receive(ws, &data))
+
+		if data[0] == websocketHeaderVersion {
+			frames = frames + 1
+			continue
+		}
+
+		message := new(websocketMessage)
+		assert.NoError(t, json.Unmarshal(data, message))
+
+		return message, frames
+	}
+}
+
+func Test_Websocket(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	_, base, _ := startServer(t, bars)
+
+	ws, err := dialWebsocket(t, base, "/ws/stream/bars", base)
+	assert.NoError(t, err)
+
+	var data []byte
+	assert.NoError(t, websocket.Message.Receive(ws, &data))
+	assert.Equal(t, byte(websocketHeaderVersion), data[0])
+	assert.Zero(t, data[1], "no placeholder flag")
+
+	length := int(binary.BigEndian.Uint16(data[2:]))
+	assert.Equal(t, websocketHeaderLength, length)
+	assert.NotZero(t, binary.BigEndian.Uint32(data[4:]), "sequence")
+	captured := math.Float64frombits(binary.BigEndian.Uint64(data[8:]))
+	sent := math.Float64frombits(binary.BigEndian.Uint64(data[16:]))
+	assert.GreaterOrEqual(t, sent, captured)
+	assert.Equal(t, uint16(fakeWidth), binary.BigEndian.Uint16(data[24:]))
+	assert.Equal(t, uint16(fakeHeight), binary.BigEndian.Uint16(data[26:]))
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data[length:]))
+	assert.NoError(t, err)
+	assert.Equal(t, fakeWidth, config.Width)
+
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandPing, Time: 1234}))
+	pong, _ := receiveText(t, ws)
+	assert.Equal(t, websocketMessagePong, pong.Type)
+	assert.Equal(t, float64(1234), pong.Time)
+	assert.Greater(t, pong.Server, float64(0))
+
+	// commands are handled in order: no frame follows the pong answering a ping sent after pause
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandPause}))
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandPing, Time: 1}))
+	receiveText(t, ws)
+
+	ws.SetReadDeadline(time.Now().Add(10 * fakeFrameInterval))
+	err = websocket.Message.Receive(ws, &data)
+	if assert.Error(t, err, "paused viewers receive no frame") {
+		timeout, ok := err.(net.Error)
+		assert.True(t, ok && timeout.Timeout())
+	}
+}
+
+func Test_WebsocketResume(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	_, base, _ := startServer(t, bars)
+
+	ws, err := dialWebsocket(t, base, "/ws/stream", base)
+	assert.NoError(t, err)
+
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandPause}))
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandResume}))
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandFrameRate, FrameRate: 10}))
+
+	// frames of the resumed stream arrive before the answer to a ping sent a few frames later
+	time.Sleep(10 * fakeFrameInterval)
+	assert.NoError(t, websocket.JSON.Send(ws, &websocketMessage{Type: websocketCommandPing, Time: 1}))
+	_, frames := receiveText(t, ws)
+	assert.Greater(t, frames, 0)
+}
+
+func Test_WebsocketOrigin(t *testing.T) {
+	bars := newFakeCamera(t, "bars")
+	_, base, _ := startServer(t, bars)
+
+	_, err := dialWebsocket(t, base, "/ws/stream", "http://evil.example")
+	assert.Error(t, err, "cross-origin connections are refused")
+
+	res := get(t, base+"/ws/stream/garage")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}